@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // where the node starts in the source
 }
 
 type Statement interface {
@@ -33,6 +34,13 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -45,10 +53,14 @@ func (p *Program) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+	// Depth is set by the resolver on assignment targets: the number of
+	// scopes out from the current one where the variable lives
+	Depth int
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos() }
 func (i *Identifier) String() string       { return i.Value }
 
 // IntegerLiteral represents a numeric value
@@ -59,8 +71,20 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos() }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// FloatLiteral represents a decimal value: 3.14 or two point five
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 // StringLiteral represents a string value
 type StringLiteral struct {
 	Token token.Token
@@ -69,8 +93,36 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos() }
 func (sl *StringLiteral) String() string       { return "\"" + sl.Value + "\"" }
 
+// InterpolatedString represents: "Hello, {name}!"
+// Parts holds the literal text pieces (as StringLiterals) and the embedded
+// expressions in source order.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos() }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(text.Value)
+		} else {
+			out.WriteString("{")
+			out.WriteString(part.String())
+			out.WriteString("}")
+		}
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
 // BooleanLiteral represents a boolean value
 type BooleanLiteral struct {
 	Token token.Token
@@ -79,6 +131,7 @@ type BooleanLiteral struct {
 
 func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BooleanLiteral) Pos() token.Position  { return bl.Token.Pos() }
 func (bl *BooleanLiteral) String() string       { return bl.Token.Literal }
 
 // ListLiteral represents a list
@@ -89,6 +142,7 @@ type ListLiteral struct {
 
 func (ll *ListLiteral) expressionNode()      {}
 func (ll *ListLiteral) TokenLiteral() string { return ll.Token.Literal }
+func (ll *ListLiteral) Pos() token.Position  { return ll.Token.Pos() }
 func (ll *ListLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -100,6 +154,35 @@ func (ll *ListLiteral) String() string {
 	return out.String()
 }
 
+// DictionaryPair represents a key-value entry in a dictionary literal
+type DictionaryPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// DictionaryLiteral represents: a dictionary with "name" as "Alice" and "age" as 30
+type DictionaryLiteral struct {
+	Token token.Token
+	Pairs []DictionaryPair
+}
+
+func (dl *DictionaryLiteral) expressionNode()      {}
+func (dl *DictionaryLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DictionaryLiteral) Pos() token.Position  { return dl.Token.Pos() }
+func (dl *DictionaryLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("a dictionary")
+	if len(dl.Pairs) > 0 {
+		pairs := []string{}
+		for _, pair := range dl.Pairs {
+			pairs = append(pairs, pair.Key.String()+" as "+pair.Value.String())
+		}
+		out.WriteString(" with ")
+		out.WriteString(strings.Join(pairs, " and "))
+	}
+	return out.String()
+}
+
 // SetStatement represents: set x to 5
 type SetStatement struct {
 	Token token.Token
@@ -109,6 +192,7 @@ type SetStatement struct {
 
 func (ss *SetStatement) statementNode()       {}
 func (ss *SetStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SetStatement) Pos() token.Position  { return ss.Token.Pos() }
 func (ss *SetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("set ")
@@ -120,6 +204,252 @@ func (ss *SetStatement) String() string {
 	return out.String()
 }
 
+// LetStatement represents: let x be 5
+// It always creates a variable in the current scope, shadowing any outer one.
+type LetStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ls *LetStatement) statementNode()       {}
+func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos() }
+func (ls *LetStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("let ")
+	out.WriteString(ls.Name.String())
+	out.WriteString(" be ")
+	if ls.Value != nil {
+		out.WriteString(ls.Value.String())
+	}
+	return out.String()
+}
+
+// GlobalStatement represents: global x
+// Assignments to x in the current scope then go to the top-level variable.
+type GlobalStatement struct {
+	Token token.Token
+	Names []*Identifier
+}
+
+func (gs *GlobalStatement) statementNode()       {}
+func (gs *GlobalStatement) TokenLiteral() string { return gs.Token.Literal }
+func (gs *GlobalStatement) Pos() token.Position  { return gs.Token.Pos() }
+func (gs *GlobalStatement) String() string {
+	names := []string{}
+	for _, n := range gs.Names {
+		names = append(names, n.String())
+	}
+	return "global " + strings.Join(names, " and ")
+}
+
+// SetKeyStatement represents: set "email" of user to "a@b.com"
+type SetKeyStatement struct {
+	Token  token.Token
+	Key    Expression
+	Target *Identifier
+	Value  Expression
+}
+
+func (sk *SetKeyStatement) statementNode()       {}
+func (sk *SetKeyStatement) TokenLiteral() string { return sk.Token.Literal }
+func (sk *SetKeyStatement) Pos() token.Position  { return sk.Token.Pos() }
+func (sk *SetKeyStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("set ")
+	out.WriteString(sk.Key.String())
+	out.WriteString(" of ")
+	out.WriteString(sk.Target.String())
+	out.WriteString(" to ")
+	if sk.Value != nil {
+		out.WriteString(sk.Value.String())
+	}
+	return out.String()
+}
+
+// RemoveStatement represents: remove "age" from user
+// or remove item 3 from notes, where Position is set instead of Key
+type RemoveStatement struct {
+	Token    token.Token
+	Key      Expression
+	Position Expression
+	Target   *Identifier
+}
+
+func (rs *RemoveStatement) statementNode()       {}
+func (rs *RemoveStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RemoveStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *RemoveStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("remove ")
+	if rs.Position != nil {
+		out.WriteString("item ")
+		out.WriteString(rs.Position.String())
+	} else {
+		out.WriteString(rs.Key.String())
+	}
+	out.WriteString(" from ")
+	out.WriteString(rs.Target.String())
+	return out.String()
+}
+
+// KeysOfExpression represents: keys of user
+type KeysOfExpression struct {
+	Token  token.Token
+	Source Expression
+}
+
+func (ko *KeysOfExpression) expressionNode()      {}
+func (ko *KeysOfExpression) TokenLiteral() string { return ko.Token.Literal }
+func (ko *KeysOfExpression) Pos() token.Position  { return ko.Token.Pos() }
+func (ko *KeysOfExpression) String() string {
+	return "keys of " + ko.Source.String()
+}
+
+// ValuesOfExpression represents: values of user
+type ValuesOfExpression struct {
+	Token  token.Token
+	Source Expression
+}
+
+func (vo *ValuesOfExpression) expressionNode()      {}
+func (vo *ValuesOfExpression) TokenLiteral() string { return vo.Token.Literal }
+func (vo *ValuesOfExpression) Pos() token.Position  { return vo.Token.Pos() }
+func (vo *ValuesOfExpression) String() string {
+	return "values of " + vo.Source.String()
+}
+
+// WhereExpression represents: items where is_even
+// The condition is a function that is called with each item.
+type WhereExpression struct {
+	Token     token.Token
+	List      Expression
+	Condition Expression
+}
+
+func (we *WhereExpression) expressionNode()      {}
+func (we *WhereExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhereExpression) Pos() token.Position  { return we.Token.Pos() }
+func (we *WhereExpression) String() string {
+	return we.List.String() + " where " + we.Condition.String()
+}
+
+// TransformExpression represents: items transformed by double
+type TransformExpression struct {
+	Token    token.Token
+	List     Expression
+	Function Expression
+}
+
+func (te *TransformExpression) expressionNode()      {}
+func (te *TransformExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TransformExpression) Pos() token.Position  { return te.Token.Pos() }
+func (te *TransformExpression) String() string {
+	return te.List.String() + " transformed by " + te.Function.String()
+}
+
+// SortExpression represents: items sorted, items sorted by get_age or
+// items sorted by field "age". Key and Field are both nil for a plain sort.
+type SortExpression struct {
+	Token token.Token
+	List  Expression
+	Key   Expression // function giving the value to sort each item by
+	Field Expression // name of the field to sort dictionaries or json by
+}
+
+func (se *SortExpression) expressionNode()      {}
+func (se *SortExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SortExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SortExpression) String() string {
+	switch {
+	case se.Key != nil:
+		return se.List.String() + " sorted by " + se.Key.String()
+	case se.Field != nil:
+		return se.List.String() + " sorted by field " + se.Field.String()
+	}
+	return se.List.String() + " sorted"
+}
+
+// AggregateExpression represents: the sum of items, the average of items,
+// the max of items, the min of items
+type AggregateExpression struct {
+	Token    token.Token
+	Operator string // "sum", "average", "max", "min"
+	List     Expression
+}
+
+func (ae *AggregateExpression) expressionNode()      {}
+func (ae *AggregateExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AggregateExpression) Pos() token.Position  { return ae.Token.Pos() }
+func (ae *AggregateExpression) String() string {
+	return "the " + ae.Operator + " of " + ae.List.String()
+}
+
+// ReduceExpression represents: total of items using add starting from 0
+type ReduceExpression struct {
+	Token    token.Token
+	List     Expression
+	Function Expression
+	Initial  Expression // nil to start from the first item
+}
+
+func (re *ReduceExpression) expressionNode()      {}
+func (re *ReduceExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *ReduceExpression) Pos() token.Position  { return re.Token.Pos() }
+func (re *ReduceExpression) String() string {
+	out := "total of " + re.List.String() + " using " + re.Function.String()
+	if re.Initial != nil {
+		out += " starting from " + re.Initial.String()
+	}
+	return out
+}
+
+// ReverseExpression represents: reverse of items
+type ReverseExpression struct {
+	Token token.Token
+	List  Expression
+}
+
+func (re *ReverseExpression) expressionNode()      {}
+func (re *ReverseExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *ReverseExpression) Pos() token.Position  { return re.Token.Pos() }
+func (re *ReverseExpression) String() string {
+	return "reverse of " + re.List.String()
+}
+
+// UniqueExpression represents: unique items in tags
+type UniqueExpression struct {
+	Token token.Token
+	List  Expression
+}
+
+func (ue *UniqueExpression) expressionNode()      {}
+func (ue *UniqueExpression) TokenLiteral() string { return ue.Token.Literal }
+func (ue *UniqueExpression) Pos() token.Position  { return ue.Token.Pos() }
+func (ue *UniqueExpression) String() string {
+	return "unique items in " + ue.List.String()
+}
+
+// TakeExpression represents: first 5 items of list, last 2 items of list
+type TakeExpression struct {
+	Token   token.Token
+	FromEnd bool // "last" rather than "first"
+	Count   Expression
+	List    Expression
+}
+
+func (te *TakeExpression) expressionNode()      {}
+func (te *TakeExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TakeExpression) Pos() token.Position  { return te.Token.Pos() }
+func (te *TakeExpression) String() string {
+	word := "first "
+	if te.FromEnd {
+		word = "last "
+	}
+	return word + te.Count.String() + " items of " + te.List.String()
+}
+
 // ArithmeticExpression represents: x plus y, x minus y, x times y, x divided by y
 type ArithmeticExpression struct {
 	Token    token.Token
@@ -130,6 +460,7 @@ type ArithmeticExpression struct {
 
 func (ae *ArithmeticExpression) expressionNode()      {}
 func (ae *ArithmeticExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *ArithmeticExpression) Pos() token.Position  { return ae.Token.Pos() }
 func (ae *ArithmeticExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ae.Left.String())
@@ -153,6 +484,7 @@ type IncreaseStatement struct {
 
 func (is *IncreaseStatement) statementNode()       {}
 func (is *IncreaseStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *IncreaseStatement) Pos() token.Position  { return is.Token.Pos() }
 func (is *IncreaseStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("increase ")
@@ -171,6 +503,7 @@ type DecreaseStatement struct {
 
 func (ds *DecreaseStatement) statementNode()       {}
 func (ds *DecreaseStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DecreaseStatement) Pos() token.Position  { return ds.Token.Pos() }
 func (ds *DecreaseStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("decrease ")
@@ -190,6 +523,7 @@ type IfStatement struct {
 
 func (is *IfStatement) statementNode()       {}
 func (is *IfStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *IfStatement) Pos() token.Position  { return is.Token.Pos() }
 func (is *IfStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("if ")
@@ -203,26 +537,149 @@ func (is *IfStatement) String() string {
 	return out.String()
 }
 
+// CheckStatement represents:
+// check x: when 1 then ... when 2 or 3 then ... when 4 to 9 then ... otherwise ... done
+type CheckStatement struct {
+	Token     token.Token
+	Subject   Expression
+	Cases     []*CheckCase
+	Otherwise *BlockStatement // optional
+}
+
+// CheckCase is one "when ... then" arm of a check statement
+type CheckCase struct {
+	Token   token.Token // the WHEN token
+	Matches []CheckMatch
+	Body    *BlockStatement
+}
+
+// CheckMatch is a single value, or an inclusive range when To is set
+type CheckMatch struct {
+	Value Expression
+	To    Expression // optional: end of the range starting at Value
+}
+
+func (cs *CheckStatement) statementNode()       {}
+func (cs *CheckStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *CheckStatement) Pos() token.Position  { return cs.Token.Pos() }
+func (cs *CheckStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("check ")
+	out.WriteString(cs.Subject.String())
+	out.WriteString(": ")
+	for _, c := range cs.Cases {
+		matches := []string{}
+		for _, m := range c.Matches {
+			if m.To != nil {
+				matches = append(matches, m.Value.String()+" to "+m.To.String())
+			} else {
+				matches = append(matches, m.Value.String())
+			}
+		}
+		out.WriteString("when ")
+		out.WriteString(strings.Join(matches, " or "))
+		out.WriteString(" then ")
+		for _, s := range c.Body.Statements {
+			out.WriteString(s.String())
+			out.WriteString(" ")
+		}
+	}
+	if cs.Otherwise != nil {
+		out.WriteString("otherwise ")
+		for _, s := range cs.Otherwise.Statements {
+			out.WriteString(s.String())
+			out.WriteString(" ")
+		}
+	}
+	out.WriteString("done")
+	return out.String()
+}
+
 // ComparisonExpression represents: x equals y, x is greater than y, etc.
 type ComparisonExpression struct {
 	Token    token.Token
 	Left     Expression
-	Operator string // "equals", "greater", "less"
-	Right    Expression
+	Operator string     // "equals", "greater", "less", "at least", "at most", "between", "empty", "in", "contains", "starts with", "ends with"
+	Right    Expression // nil for "empty"
+	Upper    Expression // "between" only: the upper bound, with Right the lower
+	Negated  bool       // is not, does not
 }
 
 func (ce *ComparisonExpression) expressionNode()      {}
 func (ce *ComparisonExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ComparisonExpression) Pos() token.Position  { return ce.Token.Pos() }
 func (ce *ComparisonExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ce.Left.String())
+	if ce.Negated {
+		out.WriteString(" not")
+	}
 	out.WriteString(" ")
 	out.WriteString(ce.Operator)
-	out.WriteString(" ")
-	out.WriteString(ce.Right.String())
+	if ce.Right != nil {
+		out.WriteString(" ")
+		out.WriteString(ce.Right.String())
+	}
+	if ce.Upper != nil {
+		out.WriteString(" and ")
+		out.WriteString(ce.Upper.String())
+	}
 	return out.String()
 }
 
+// ConversionExpression represents: answer as a number, count as text
+type ConversionExpression struct {
+	Token  token.Token
+	Value  Expression
+	Target string // "number", "text", "boolean" or "list"
+}
+
+func (ce *ConversionExpression) expressionNode()      {}
+func (ce *ConversionExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConversionExpression) Pos() token.Position  { return ce.Token.Pos() }
+func (ce *ConversionExpression) String() string {
+	if ce.Target == "text" {
+		return "(" + ce.Value.String() + " as text)"
+	}
+	return "(" + ce.Value.String() + " as a " + ce.Target + ")"
+}
+
+// TypeCheckExpression represents: x is a number, x is text, x is not nothing
+type TypeCheckExpression struct {
+	Token    token.Token
+	Value    Expression
+	TypeName string // a name that "type of" gives
+	Negated  bool
+}
+
+func (tc *TypeCheckExpression) expressionNode()      {}
+func (tc *TypeCheckExpression) TokenLiteral() string { return tc.Token.Literal }
+func (tc *TypeCheckExpression) Pos() token.Position  { return tc.Token.Pos() }
+func (tc *TypeCheckExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(tc.Value.String())
+	out.WriteString(" is ")
+	if tc.Negated {
+		out.WriteString("not ")
+	}
+	if tc.TypeName != "text" && tc.TypeName != "nothing" {
+		out.WriteString("a ")
+	}
+	out.WriteString(tc.TypeName)
+	return out.String()
+}
+
+// TypeOfExpression represents: type of x
+type TypeOfExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (to *TypeOfExpression) expressionNode()      {}
+func (to *TypeOfExpression) TokenLiteral() string { return to.Token.Literal }
+func (to *TypeOfExpression) Pos() token.Position  { return to.Token.Pos() }
+func (to *TypeOfExpression) String() string       { return "type of " + to.Value.String() }
+
 // LogicalExpression represents: x and y, x or y, not x
 type LogicalExpression struct {
 	Token    token.Token
@@ -233,6 +690,7 @@ type LogicalExpression struct {
 
 func (le *LogicalExpression) expressionNode()      {}
 func (le *LogicalExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LogicalExpression) Pos() token.Position  { return le.Token.Pos() }
 func (le *LogicalExpression) String() string {
 	var out bytes.Buffer
 	if le.Left != nil {
@@ -256,6 +714,7 @@ type WhileStatement struct {
 
 func (ws *WhileStatement) statementNode()       {}
 func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos() }
 func (ws *WhileStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("while ")
@@ -265,20 +724,27 @@ func (ws *WhileStatement) String() string {
 	return out.String()
 }
 
-// ForStatement represents: for each item in items do ... done
+// ForStatement represents: for each item in items do ... done,
+// or for each key and value in data do ... done
 type ForStatement struct {
 	Token    token.Token
 	Variable *Identifier
+	Value    *Identifier // optional: second variable, which makes Variable the key
 	Iterable Expression
 	Body     *BlockStatement
 }
 
 func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos() }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("for each ")
 	out.WriteString(fs.Variable.String())
+	if fs.Value != nil {
+		out.WriteString(" and ")
+		out.WriteString(fs.Value.String())
+	}
 	out.WriteString(" in ")
 	out.WriteString(fs.Iterable.String())
 	out.WriteString(" do ")
@@ -286,6 +752,70 @@ func (fs *ForStatement) String() string {
 	return out.String()
 }
 
+// ForRangeStatement represents: for each n from 1 to 10 by 2 do ... done
+type ForRangeStatement struct {
+	Token    token.Token
+	Variable *Identifier
+	From     Expression
+	To       Expression
+	Step     Expression // optional
+	Body     *BlockStatement
+}
+
+func (fr *ForRangeStatement) statementNode()       {}
+func (fr *ForRangeStatement) TokenLiteral() string { return fr.Token.Literal }
+func (fr *ForRangeStatement) Pos() token.Position  { return fr.Token.Pos() }
+func (fr *ForRangeStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for each ")
+	out.WriteString(fr.Variable.String())
+	out.WriteString(" from ")
+	out.WriteString(fr.From.String())
+	out.WriteString(" to ")
+	out.WriteString(fr.To.String())
+	if fr.Step != nil {
+		out.WriteString(" by ")
+		out.WriteString(fr.Step.String())
+	}
+	out.WriteString(" do ")
+	out.WriteString(fr.Body.String())
+	return out.String()
+}
+
+// RepeatStatement represents: repeat 5 times do ... done
+type RepeatStatement struct {
+	Token token.Token
+	Count Expression
+	Body  *BlockStatement
+}
+
+func (rs *RepeatStatement) statementNode()       {}
+func (rs *RepeatStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RepeatStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *RepeatStatement) String() string {
+	return "repeat " + rs.Count.String() + " times do " + rs.Body.String()
+}
+
+// StopLoopStatement represents: stop the loop
+type StopLoopStatement struct {
+	Token token.Token
+}
+
+func (sl *StopLoopStatement) statementNode()       {}
+func (sl *StopLoopStatement) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StopLoopStatement) Pos() token.Position  { return sl.Token.Pos() }
+func (sl *StopLoopStatement) String() string       { return "stop the loop" }
+
+// SkipStatement represents: skip to next
+type SkipStatement struct {
+	Token token.Token
+}
+
+func (ss *SkipStatement) statementNode()       {}
+func (ss *SkipStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SkipStatement) Pos() token.Position  { return ss.Token.Pos() }
+func (ss *SkipStatement) String() string       { return "skip to next" }
+
 // BlockStatement represents a block of statements ending with done
 type BlockStatement struct {
 	Token      token.Token
@@ -294,6 +824,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos() }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -305,55 +836,150 @@ func (bs *BlockStatement) String() string {
 }
 
 // FunctionDefinition represents: to greet with name ... done
+// Defaults holds, for each parameter, the expression after "defaulting to",
+// or nil if the parameter is required.
 type FunctionDefinition struct {
 	Token      token.Token
 	Name       *Identifier
 	Parameters []*Identifier
+	Defaults   []Expression
 	Body       *BlockStatement
 }
 
 func (fd *FunctionDefinition) statementNode()       {}
 func (fd *FunctionDefinition) TokenLiteral() string { return fd.Token.Literal }
+func (fd *FunctionDefinition) Pos() token.Position  { return fd.Token.Pos() }
 func (fd *FunctionDefinition) String() string {
 	var out bytes.Buffer
 	out.WriteString("to ")
 	out.WriteString(fd.Name.String())
 	if len(fd.Parameters) > 0 {
 		out.WriteString(" with ")
-		params := []string{}
-		for _, p := range fd.Parameters {
-			params = append(params, p.String())
-		}
-		out.WriteString(strings.Join(params, " and "))
+		out.WriteString(parametersString(fd.Parameters, fd.Defaults))
 	}
 	out.WriteString(" ")
 	out.WriteString(fd.Body.String())
 	return out.String()
 }
 
-// CallExpression represents: funcname with args
+// FunctionLiteral represents an unnamed function:
+// a function with x that returns x times 2, or a function with x do ... done
+type FunctionLiteral struct {
+	Token      token.Token // the 'a' token
+	Parameters []*Identifier
+	Defaults   []Expression
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("a function")
+	if len(fl.Parameters) > 0 {
+		out.WriteString(" with ")
+		out.WriteString(parametersString(fl.Parameters, fl.Defaults))
+	}
+	out.WriteString(" do ")
+	out.WriteString(fl.Body.String())
+	return out.String()
+}
+
+func parametersString(params []*Identifier, defaults []Expression) string {
+	parts := []string{}
+	for i, p := range params {
+		if i < len(defaults) && defaults[i] != nil {
+			parts = append(parts, p.String()+" defaulting to "+defaults[i].String())
+		} else {
+			parts = append(parts, p.String())
+		}
+	}
+	return strings.Join(parts, " and ")
+}
+
+// CallExpression represents: funcname with args, call funcname, or
+// (expression) with args where the expression produces a function.
+// Named arguments follow the positional ones: greet with name as "Bob"
 type CallExpression struct {
 	Token     token.Token
-	Function  *Identifier
+	Function  Expression
 	Arguments []Expression
+	Named     []NamedArgument
+}
+
+// NamedArgument is one "name as value" argument in a call
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos() }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ce.Function.String())
-	if len(ce.Arguments) > 0 {
+	if len(ce.Arguments) > 0 || len(ce.Named) > 0 {
 		out.WriteString(" with ")
 		args := []string{}
 		for _, a := range ce.Arguments {
 			args = append(args, a.String())
 		}
+		for _, n := range ce.Named {
+			args = append(args, n.Name.String()+" as "+n.Value.String())
+		}
 		out.WriteString(strings.Join(args, " and "))
 	}
 	return out.String()
 }
 
+// TryStatement represents:
+// try ... if it fails with problem ... done, or try ... otherwise ... done
+type TryStatement struct {
+	Token    token.Token
+	Body     *BlockStatement
+	ErrorVar *Identifier     // optional: receives the caught error
+	Handler  *BlockStatement // optional: runs when the body fails
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) Pos() token.Position  { return ts.Token.Pos() }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	for _, s := range ts.Body.Statements {
+		out.WriteString(s.String())
+		out.WriteString(" ")
+	}
+	if ts.Handler != nil {
+		out.WriteString("if it fails ")
+		if ts.ErrorVar != nil {
+			out.WriteString("with ")
+			out.WriteString(ts.ErrorVar.String())
+			out.WriteString(" ")
+		}
+		out.WriteString(ts.Handler.String())
+	} else {
+		out.WriteString("done")
+	}
+	return out.String()
+}
+
+// RaiseStatement represents: raise "message"
+type RaiseStatement struct {
+	Token   token.Token
+	Message Expression
+}
+
+func (rs *RaiseStatement) statementNode()       {}
+func (rs *RaiseStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RaiseStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *RaiseStatement) String() string {
+	return "raise " + rs.Message.String()
+}
+
 // ReturnStatement represents: return x
 type ReturnStatement struct {
 	Token       token.Token
@@ -362,6 +988,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos() }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("return ")
@@ -371,6 +998,76 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ExpressionStatement represents an expression used on its own line, such
+// as a call whose result is not needed: greet with "Alice"
+type ExpressionStatement struct {
+	Token      token.Token
+	Expression Expression
+}
+
+func (es *ExpressionStatement) statementNode()       {}
+func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos() }
+func (es *ExpressionStatement) String() string {
+	return es.Expression.String()
+}
+
+// UseStatement represents: use "lib/auth.abc", or use auth from
+// "lib/auth.abc". Without a Name the module's exports are defined directly
+// in the file that uses it. A Standard use, as in use standard "lists",
+// names a module built into the interpreter instead of a file.
+type UseStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Path     string
+	Standard bool
+}
+
+func (us *UseStatement) statementNode()       {}
+func (us *UseStatement) TokenLiteral() string { return us.Token.Literal }
+func (us *UseStatement) Pos() token.Position  { return us.Token.Pos() }
+func (us *UseStatement) String() string {
+	source := "\"" + us.Path + "\""
+	if us.Standard {
+		source = "standard " + source
+	}
+	if us.Name != nil {
+		return "use " + us.Name.String() + " from " + source
+	}
+	return "use " + source
+}
+
+// ExportStatement represents: export check_token and make_user
+type ExportStatement struct {
+	Token token.Token
+	Names []*Identifier
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) Pos() token.Position  { return es.Token.Pos() }
+func (es *ExportStatement) String() string {
+	names := []string{}
+	for _, name := range es.Names {
+		names = append(names, name.String())
+	}
+	return "export " + strings.Join(names, " and ")
+}
+
+// MemberExpression represents: auth's check_token
+type MemberExpression struct {
+	Token  token.Token // the 's
+	Module Expression
+	Name   *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) Pos() token.Position  { return me.Token.Pos() }
+func (me *MemberExpression) String() string {
+	return me.Module.String() + "'s " + me.Name.String()
+}
+
 // SayStatement represents: say x
 type SayStatement struct {
 	Token token.Token
@@ -379,6 +1076,7 @@ type SayStatement struct {
 
 func (ss *SayStatement) statementNode()       {}
 func (ss *SayStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SayStatement) Pos() token.Position  { return ss.Token.Pos() }
 func (ss *SayStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("say ")
@@ -394,6 +1092,7 @@ type AskStatement struct {
 
 func (as *AskStatement) statementNode()       {}
 func (as *AskStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AskStatement) Pos() token.Position  { return as.Token.Pos() }
 func (as *AskStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("ask into ")
@@ -409,6 +1108,7 @@ type LengthExpression struct {
 
 func (le *LengthExpression) expressionNode()      {}
 func (le *LengthExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LengthExpression) Pos() token.Position  { return le.Token.Pos() }
 func (le *LengthExpression) String() string {
 	return "length of " + le.List.String()
 }
@@ -422,6 +1122,7 @@ type AppendStatement struct {
 
 func (as *AppendStatement) statementNode()       {}
 func (as *AppendStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AppendStatement) Pos() token.Position  { return as.Token.Pos() }
 func (as *AppendStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("append ")
@@ -431,6 +1132,289 @@ func (as *AppendStatement) String() string {
 	return out.String()
 }
 
+// SetItemStatement represents: set item 2 of notes to "text"
+type SetItemStatement struct {
+	Token    token.Token
+	Position Expression
+	Target   *Identifier
+	Value    Expression
+}
+
+func (si *SetItemStatement) statementNode()       {}
+func (si *SetItemStatement) TokenLiteral() string { return si.Token.Literal }
+func (si *SetItemStatement) Pos() token.Position  { return si.Token.Pos() }
+func (si *SetItemStatement) String() string {
+	return "set item " + si.Position.String() + " of " + si.Target.String() + " to " + si.Value.String()
+}
+
+// InsertStatement represents: insert "text" at position 2 in notes
+type InsertStatement struct {
+	Token    token.Token
+	Value    Expression
+	Position Expression
+	Target   *Identifier
+}
+
+func (is *InsertStatement) statementNode()       {}
+func (is *InsertStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *InsertStatement) Pos() token.Position  { return is.Token.Pos() }
+func (is *InsertStatement) String() string {
+	return "insert " + is.Value.String() + " at position " + is.Position.String() + " in " + is.Target.String()
+}
+
+// PopStatement represents: pop from notes, or pop item 1 from queue into first
+// Position is nil to take the last item, and Into is nil to discard it.
+type PopStatement struct {
+	Token    token.Token
+	Position Expression
+	Target   *Identifier
+	Into     *Identifier
+}
+
+func (ps *PopStatement) statementNode()       {}
+func (ps *PopStatement) TokenLiteral() string { return ps.Token.Literal }
+func (ps *PopStatement) Pos() token.Position  { return ps.Token.Pos() }
+func (ps *PopStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("pop ")
+	if ps.Position != nil {
+		out.WriteString("item ")
+		out.WriteString(ps.Position.String())
+		out.WriteString(" ")
+	}
+	out.WriteString("from ")
+	out.WriteString(ps.Target.String())
+	if ps.Into != nil {
+		out.WriteString(" into ")
+		out.WriteString(ps.Into.String())
+	}
+	return out.String()
+}
+
+// SliceExpression represents: items 2 to 5 from notes
+type SliceExpression struct {
+	Token token.Token
+	From  Expression
+	To    Expression
+	List  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SliceExpression) String() string {
+	return "items " + se.From.String() + " to " + se.To.String() + " from " + se.List.String()
+}
+
+// SplitExpression represents: split line by ","
+type SplitExpression struct {
+	Token     token.Token
+	Text      Expression
+	Separator Expression
+}
+
+func (se *SplitExpression) expressionNode()      {}
+func (se *SplitExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SplitExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SplitExpression) String() string {
+	return "split " + se.Text.String() + " by " + se.Separator.String()
+}
+
+// JoinExpression represents: join names with ", "
+// Separator is nil when the items are joined with nothing between them.
+type JoinExpression struct {
+	Token     token.Token
+	List      Expression
+	Separator Expression
+}
+
+func (je *JoinExpression) expressionNode()      {}
+func (je *JoinExpression) TokenLiteral() string { return je.Token.Literal }
+func (je *JoinExpression) Pos() token.Position  { return je.Token.Pos() }
+func (je *JoinExpression) String() string {
+	if je.Separator == nil {
+		return "join " + je.List.String()
+	}
+	return "join " + je.List.String() + " with " + je.Separator.String()
+}
+
+// LetterCaseExpression represents: uppercase of name, lowercase of name
+type LetterCaseExpression struct {
+	Token token.Token
+	Upper bool
+	Text  Expression
+}
+
+func (lc *LetterCaseExpression) expressionNode()      {}
+func (lc *LetterCaseExpression) TokenLiteral() string { return lc.Token.Literal }
+func (lc *LetterCaseExpression) Pos() token.Position  { return lc.Token.Pos() }
+func (lc *LetterCaseExpression) String() string {
+	return lc.Token.Literal + " of " + lc.Text.String()
+}
+
+// TrimExpression represents: trim input
+type TrimExpression struct {
+	Token token.Token
+	Text  Expression
+}
+
+func (te *TrimExpression) expressionNode()      {}
+func (te *TrimExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TrimExpression) Pos() token.Position  { return te.Token.Pos() }
+func (te *TrimExpression) String() string       { return "trim " + te.Text.String() }
+
+// ReplaceExpression represents: replace "-" with " " in title, or
+// replace pattern "[0-9]+" with "#" in title, where Pattern is set instead
+// of Old
+type ReplaceExpression struct {
+	Token   token.Token
+	Old     Expression
+	Pattern *Pattern
+	New     Expression
+	Text    Expression
+}
+
+func (re *ReplaceExpression) expressionNode()      {}
+func (re *ReplaceExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *ReplaceExpression) Pos() token.Position  { return re.Token.Pos() }
+func (re *ReplaceExpression) String() string {
+	old := re.Old
+	if re.Pattern != nil {
+		old = re.Pattern
+	}
+	return "replace " + old.String() + " with " + re.New.String() + " in " + re.Text.String()
+}
+
+// Pattern represents: pattern "[0-9]+", the regular expression used by
+// matches, the first match of and the other pattern operations
+type Pattern struct {
+	Token  token.Token
+	Source Expression
+}
+
+func (pt *Pattern) expressionNode()      {}
+func (pt *Pattern) TokenLiteral() string { return pt.Token.Literal }
+func (pt *Pattern) Pos() token.Position  { return pt.Token.Pos() }
+func (pt *Pattern) String() string       { return "pattern " + pt.Source.String() }
+
+// MatchExpression represents: email matches pattern "^[^@]+@[^@]+$"
+type MatchExpression struct {
+	Token   token.Token
+	Text    Expression
+	Pattern *Pattern
+	Negated bool // does not match
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos() }
+func (me *MatchExpression) String() string {
+	if me.Negated {
+		return me.Text.String() + " does not match " + me.Pattern.String()
+	}
+	return me.Text.String() + " matches " + me.Pattern.String()
+}
+
+// FindExpression represents: the first match of pattern "[0-9]+" in path,
+// all matches of ..., the captures of ... and all captures of ...
+type FindExpression struct {
+	Token    token.Token
+	All      bool // every match rather than the first
+	Captures bool // the groups in the pattern rather than the whole match
+	Pattern  *Pattern
+	Text     Expression
+}
+
+func (fe *FindExpression) expressionNode()      {}
+func (fe *FindExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FindExpression) Pos() token.Position  { return fe.Token.Pos() }
+func (fe *FindExpression) String() string {
+	var what string
+	switch {
+	case fe.All && fe.Captures:
+		what = "all captures"
+	case fe.All:
+		what = "all matches"
+	case fe.Captures:
+		what = "the captures"
+	default:
+		what = "the first match"
+	}
+	return what + " of " + fe.Pattern.String() + " in " + fe.Text.String()
+}
+
+// PositionExpression represents: position of "@" in email
+type PositionExpression struct {
+	Token  token.Token
+	Target Expression
+	Source Expression
+}
+
+func (pe *PositionExpression) expressionNode()      {}
+func (pe *PositionExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PositionExpression) Pos() token.Position  { return pe.Token.Pos() }
+func (pe *PositionExpression) String() string {
+	return "position of " + pe.Target.String() + " in " + pe.Source.String()
+}
+
+// CharactersExpression represents: characters 2 to 5 of name
+type CharactersExpression struct {
+	Token token.Token
+	From  Expression
+	To    Expression
+	Text  Expression
+}
+
+func (ce *CharactersExpression) expressionNode()      {}
+func (ce *CharactersExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CharactersExpression) Pos() token.Position  { return ce.Token.Pos() }
+func (ce *CharactersExpression) String() string {
+	return "characters " + ce.From.String() + " to " + ce.To.String() + " of " + ce.Text.String()
+}
+
+// RepeatedExpression represents: "-" repeated 20 times
+type RepeatedExpression struct {
+	Token token.Token
+	Text  Expression
+	Count Expression
+}
+
+func (re *RepeatedExpression) expressionNode()      {}
+func (re *RepeatedExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RepeatedExpression) Pos() token.Position  { return re.Token.Pos() }
+func (re *RepeatedExpression) String() string {
+	return "(" + re.Text.String() + " repeated " + re.Count.String() + " times)"
+}
+
+// PadExpression represents: pad code to 6 with "0" on the left
+// Fill is nil to pad with spaces.
+type PadExpression struct {
+	Token token.Token
+	Text  Expression
+	Width Expression
+	Fill  Expression
+	Left  bool
+}
+
+func (pe *PadExpression) expressionNode()      {}
+func (pe *PadExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PadExpression) Pos() token.Position  { return pe.Token.Pos() }
+func (pe *PadExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("pad ")
+	out.WriteString(pe.Text.String())
+	out.WriteString(" to ")
+	out.WriteString(pe.Width.String())
+	if pe.Fill != nil {
+		out.WriteString(" with ")
+		out.WriteString(pe.Fill.String())
+	}
+	if pe.Left {
+		out.WriteString(" on the left")
+	}
+	return out.String()
+}
+
 // IndexExpression represents: item N from list (as expression)
 type IndexExpression struct {
 	Token token.Token
@@ -440,6 +1424,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos() }
 func (ie *IndexExpression) String() string {
 	return "item " + ie.Index.String() + " from " + ie.List.String()
 }
@@ -452,6 +1437,7 @@ type NegativeExpression struct {
 
 func (ne *NegativeExpression) expressionNode()      {}
 func (ne *NegativeExpression) TokenLiteral() string { return ne.Token.Literal }
+func (ne *NegativeExpression) Pos() token.Position  { return ne.Token.Pos() }
 func (ne *NegativeExpression) String() string {
 	return "minus " + ne.Value.String()
 }
@@ -462,12 +1448,13 @@ func (ne *NegativeExpression) String() string {
 type FetchStatement struct {
 	Token   token.Token
 	URL     Expression
-	Headers Expression   // optional: headers list
+	Headers Expression // optional: headers list
 	Target  *Identifier
 }
 
 func (fs *FetchStatement) statementNode()       {}
 func (fs *FetchStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FetchStatement) Pos() token.Position  { return fs.Token.Pos() }
 func (fs *FetchStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("fetch from ")
@@ -492,6 +1479,7 @@ type SendStatement struct {
 
 func (ss *SendStatement) statementNode()       {}
 func (ss *SendStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SendStatement) Pos() token.Position  { return ss.Token.Pos() }
 func (ss *SendStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("send ")
@@ -518,6 +1506,7 @@ type PutStatement struct {
 
 func (ps *PutStatement) statementNode()       {}
 func (ps *PutStatement) TokenLiteral() string { return ps.Token.Literal }
+func (ps *PutStatement) Pos() token.Position  { return ps.Token.Pos() }
 func (ps *PutStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("put ")
@@ -543,6 +1532,7 @@ type DeleteStatement struct {
 
 func (ds *DeleteStatement) statementNode()       {}
 func (ds *DeleteStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeleteStatement) Pos() token.Position  { return ds.Token.Pos() }
 func (ds *DeleteStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("delete from ")
@@ -564,6 +1554,7 @@ type BodyOfExpression struct {
 
 func (boe *BodyOfExpression) expressionNode()      {}
 func (boe *BodyOfExpression) TokenLiteral() string { return boe.Token.Literal }
+func (boe *BodyOfExpression) Pos() token.Position  { return boe.Token.Pos() }
 func (boe *BodyOfExpression) String() string {
 	return "body of " + boe.Response.String()
 }
@@ -576,6 +1567,7 @@ type StatusOfExpression struct {
 
 func (soe *StatusOfExpression) expressionNode()      {}
 func (soe *StatusOfExpression) TokenLiteral() string { return soe.Token.Literal }
+func (soe *StatusOfExpression) Pos() token.Position  { return soe.Token.Pos() }
 func (soe *StatusOfExpression) String() string {
 	return "status of " + soe.Response.String()
 }
@@ -589,6 +1581,7 @@ type HeaderFromExpression struct {
 
 func (hfe *HeaderFromExpression) expressionNode()      {}
 func (hfe *HeaderFromExpression) TokenLiteral() string { return hfe.Token.Literal }
+func (hfe *HeaderFromExpression) Pos() token.Position  { return hfe.Token.Pos() }
 func (hfe *HeaderFromExpression) String() string {
 	return "header " + hfe.HeaderName.String() + " from " + hfe.Response.String()
 }
@@ -604,6 +1597,7 @@ type ParseJsonStatement struct {
 
 func (pjs *ParseJsonStatement) statementNode()       {}
 func (pjs *ParseJsonStatement) TokenLiteral() string { return pjs.Token.Literal }
+func (pjs *ParseJsonStatement) Pos() token.Position  { return pjs.Token.Pos() }
 func (pjs *ParseJsonStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("parse ")
@@ -622,6 +1616,7 @@ type FieldFromExpression struct {
 
 func (ffe *FieldFromExpression) expressionNode()      {}
 func (ffe *FieldFromExpression) TokenLiteral() string { return ffe.Token.Literal }
+func (ffe *FieldFromExpression) Pos() token.Position  { return ffe.Token.Pos() }
 func (ffe *FieldFromExpression) String() string {
 	return "field " + ffe.FieldName.String() + " from " + ffe.Source.String()
 }
@@ -635,6 +1630,7 @@ type EncodeJsonStatement struct {
 
 func (ejs *EncodeJsonStatement) statementNode()       {}
 func (ejs *EncodeJsonStatement) TokenLiteral() string { return ejs.Token.Literal }
+func (ejs *EncodeJsonStatement) Pos() token.Position  { return ejs.Token.Pos() }
 func (ejs *EncodeJsonStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("encode ")
@@ -655,6 +1651,7 @@ type ServeStatement struct {
 
 func (ss *ServeStatement) statementNode()       {}
 func (ss *ServeStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *ServeStatement) Pos() token.Position  { return ss.Token.Pos() }
 func (ss *ServeStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("serve on ")
@@ -668,14 +1665,15 @@ func (ss *ServeStatement) String() string {
 // WhenRouteStatement represents: when get at "/path" using req do ... done
 type WhenRouteStatement struct {
 	Token      token.Token
-	Method     string          // "" for any, "GET", "POST", etc.
+	Method     string // "" for any, "GET", "POST", etc.
 	Path       Expression
-	RequestVar *Identifier     // optional request variable
+	RequestVar *Identifier // optional request variable
 	Body       *BlockStatement
 }
 
 func (wr *WhenRouteStatement) statementNode()       {}
 func (wr *WhenRouteStatement) TokenLiteral() string { return wr.Token.Literal }
+func (wr *WhenRouteStatement) Pos() token.Position  { return wr.Token.Pos() }
 func (wr *WhenRouteStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("when ")
@@ -697,14 +1695,16 @@ func (wr *WhenRouteStatement) String() string {
 }
 
 // RouteToStatement represents: route "/path" to handlerFunc
+// The handler can be any expression that produces a function.
 type RouteToStatement struct {
 	Token   token.Token
 	Path    Expression
-	Handler *Identifier
+	Handler Expression
 }
 
 func (rt *RouteToStatement) statementNode()       {}
 func (rt *RouteToStatement) TokenLiteral() string { return rt.Token.Literal }
+func (rt *RouteToStatement) Pos() token.Position  { return rt.Token.Pos() }
 func (rt *RouteToStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("route ")
@@ -724,13 +1724,14 @@ type HeaderPair struct {
 type ReplyStatement struct {
 	Token      token.Token
 	Body       Expression
-	AsJson     bool           // if true, auto-encode body as JSON
-	StatusCode Expression     // optional, defaults to 200
-	Headers    []HeaderPair   // optional response headers
+	AsJson     bool         // if true, auto-encode body as JSON
+	StatusCode Expression   // optional, defaults to 200
+	Headers    []HeaderPair // optional response headers
 }
 
 func (rs *ReplyStatement) statementNode()       {}
 func (rs *ReplyStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReplyStatement) Pos() token.Position  { return rs.Token.Pos() }
 func (rs *ReplyStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("reply with ")
@@ -753,6 +1754,7 @@ type StopServerStatement struct {
 
 func (ss *StopServerStatement) statementNode()       {}
 func (ss *StopServerStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StopServerStatement) Pos() token.Position  { return ss.Token.Pos() }
 func (ss *StopServerStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("stop server")
@@ -771,6 +1773,7 @@ type MethodOfExpression struct {
 
 func (moe *MethodOfExpression) expressionNode()      {}
 func (moe *MethodOfExpression) TokenLiteral() string { return moe.Token.Literal }
+func (moe *MethodOfExpression) Pos() token.Position  { return moe.Token.Pos() }
 func (moe *MethodOfExpression) String() string {
 	return "method of " + moe.Request.String()
 }
@@ -783,6 +1786,7 @@ type PathOfExpression struct {
 
 func (poe *PathOfExpression) expressionNode()      {}
 func (poe *PathOfExpression) TokenLiteral() string { return poe.Token.Literal }
+func (poe *PathOfExpression) Pos() token.Position  { return poe.Token.Pos() }
 func (poe *PathOfExpression) String() string {
 	return "path of " + poe.Request.String()
 }
@@ -796,6 +1800,7 @@ type QueryFromExpression struct {
 
 func (qfe *QueryFromExpression) expressionNode()      {}
 func (qfe *QueryFromExpression) TokenLiteral() string { return qfe.Token.Literal }
+func (qfe *QueryFromExpression) Pos() token.Position  { return qfe.Token.Pos() }
 func (qfe *QueryFromExpression) String() string {
 	return "query " + qfe.QueryName.String() + " from " + qfe.Request.String()
 }
@@ -0,0 +1,326 @@
+package ast
+
+// Walk calls visit for node and then, if visit returns true, for each of
+// its children in source order. Optional children that are absent are
+// skipped.
+func Walk(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(s, visit)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(s, visit)
+		}
+
+	// Statements
+	case *SetStatement:
+		walkIdentifier(n.Name, visit)
+		Walk(n.Value, visit)
+	case *LetStatement:
+		walkIdentifier(n.Name, visit)
+		Walk(n.Value, visit)
+	case *GlobalStatement:
+		for _, name := range n.Names {
+			walkIdentifier(name, visit)
+		}
+	case *SetKeyStatement:
+		Walk(n.Key, visit)
+		walkIdentifier(n.Target, visit)
+		Walk(n.Value, visit)
+	case *RemoveStatement:
+		Walk(n.Key, visit)
+		Walk(n.Position, visit)
+		walkIdentifier(n.Target, visit)
+	case *SetItemStatement:
+		Walk(n.Position, visit)
+		walkIdentifier(n.Target, visit)
+		Walk(n.Value, visit)
+	case *InsertStatement:
+		Walk(n.Value, visit)
+		Walk(n.Position, visit)
+		walkIdentifier(n.Target, visit)
+	case *PopStatement:
+		Walk(n.Position, visit)
+		walkIdentifier(n.Target, visit)
+		walkIdentifier(n.Into, visit)
+	case *IncreaseStatement:
+		walkIdentifier(n.Target, visit)
+		Walk(n.Amount, visit)
+	case *DecreaseStatement:
+		walkIdentifier(n.Target, visit)
+		Walk(n.Amount, visit)
+	case *IfStatement:
+		Walk(n.Condition, visit)
+		walkBlock(n.Consequence, visit)
+		walkBlock(n.Alternative, visit)
+	case *CheckStatement:
+		Walk(n.Subject, visit)
+		for _, c := range n.Cases {
+			for _, m := range c.Matches {
+				Walk(m.Value, visit)
+				Walk(m.To, visit)
+			}
+			walkBlock(c.Body, visit)
+		}
+		walkBlock(n.Otherwise, visit)
+	case *WhileStatement:
+		Walk(n.Condition, visit)
+		walkBlock(n.Body, visit)
+	case *ForStatement:
+		walkIdentifier(n.Variable, visit)
+		walkIdentifier(n.Value, visit)
+		Walk(n.Iterable, visit)
+		walkBlock(n.Body, visit)
+	case *ForRangeStatement:
+		walkIdentifier(n.Variable, visit)
+		Walk(n.From, visit)
+		Walk(n.To, visit)
+		Walk(n.Step, visit)
+		walkBlock(n.Body, visit)
+	case *RepeatStatement:
+		Walk(n.Count, visit)
+		walkBlock(n.Body, visit)
+	case *FunctionDefinition:
+		walkIdentifier(n.Name, visit)
+		for _, param := range n.Parameters {
+			walkIdentifier(param, visit)
+		}
+		for _, d := range n.Defaults {
+			Walk(d, visit)
+		}
+		walkBlock(n.Body, visit)
+	case *TryStatement:
+		walkBlock(n.Body, visit)
+		walkIdentifier(n.ErrorVar, visit)
+		walkBlock(n.Handler, visit)
+	case *RaiseStatement:
+		Walk(n.Message, visit)
+	case *ReturnStatement:
+		Walk(n.ReturnValue, visit)
+	case *ExpressionStatement:
+		Walk(n.Expression, visit)
+	case *UseStatement:
+		walkIdentifier(n.Name, visit)
+	case *ExportStatement:
+		for _, name := range n.Names {
+			walkIdentifier(name, visit)
+		}
+	case *SayStatement:
+		Walk(n.Value, visit)
+	case *AskStatement:
+		walkIdentifier(n.Target, visit)
+	case *AppendStatement:
+		Walk(n.Value, visit)
+		walkIdentifier(n.List, visit)
+	case *FetchStatement:
+		Walk(n.URL, visit)
+		Walk(n.Headers, visit)
+		walkIdentifier(n.Target, visit)
+	case *SendStatement:
+		Walk(n.Body, visit)
+		Walk(n.URL, visit)
+		Walk(n.Headers, visit)
+		walkIdentifier(n.Target, visit)
+	case *PutStatement:
+		Walk(n.Body, visit)
+		Walk(n.URL, visit)
+		Walk(n.Headers, visit)
+		walkIdentifier(n.Target, visit)
+	case *DeleteStatement:
+		Walk(n.URL, visit)
+		Walk(n.Headers, visit)
+		walkIdentifier(n.Target, visit)
+	case *ParseJsonStatement:
+		Walk(n.Source, visit)
+		walkIdentifier(n.Target, visit)
+	case *EncodeJsonStatement:
+		Walk(n.Source, visit)
+		walkIdentifier(n.Target, visit)
+	case *ServeStatement:
+		Walk(n.Port, visit)
+	case *WhenRouteStatement:
+		Walk(n.Path, visit)
+		walkIdentifier(n.RequestVar, visit)
+		walkBlock(n.Body, visit)
+	case *RouteToStatement:
+		Walk(n.Path, visit)
+		Walk(n.Handler, visit)
+	case *ReplyStatement:
+		Walk(n.Body, visit)
+		Walk(n.StatusCode, visit)
+		for _, h := range n.Headers {
+			Walk(h.Name, visit)
+			Walk(h.Value, visit)
+		}
+	case *StopServerStatement:
+		Walk(n.Port, visit)
+
+	// Expressions
+	case *InterpolatedString:
+		for _, part := range n.Parts {
+			Walk(part, visit)
+		}
+	case *ListLiteral:
+		for _, elem := range n.Elements {
+			Walk(elem, visit)
+		}
+	case *DictionaryLiteral:
+		for _, pair := range n.Pairs {
+			Walk(pair.Key, visit)
+			Walk(pair.Value, visit)
+		}
+	case *KeysOfExpression:
+		Walk(n.Source, visit)
+	case *ValuesOfExpression:
+		Walk(n.Source, visit)
+	case *WhereExpression:
+		Walk(n.List, visit)
+		Walk(n.Condition, visit)
+	case *TransformExpression:
+		Walk(n.List, visit)
+		Walk(n.Function, visit)
+	case *SortExpression:
+		Walk(n.List, visit)
+		Walk(n.Key, visit)
+		Walk(n.Field, visit)
+	case *AggregateExpression:
+		Walk(n.List, visit)
+	case *ReduceExpression:
+		Walk(n.List, visit)
+		Walk(n.Function, visit)
+		Walk(n.Initial, visit)
+	case *ReverseExpression:
+		Walk(n.List, visit)
+	case *UniqueExpression:
+		Walk(n.List, visit)
+	case *TakeExpression:
+		Walk(n.Count, visit)
+		Walk(n.List, visit)
+	case *ArithmeticExpression:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+	case *ComparisonExpression:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+		Walk(n.Upper, visit)
+	case *ConversionExpression:
+		Walk(n.Value, visit)
+	case *TypeCheckExpression:
+		Walk(n.Value, visit)
+	case *TypeOfExpression:
+		Walk(n.Value, visit)
+	case *LogicalExpression:
+		Walk(n.Left, visit)
+		Walk(n.Right, visit)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			walkIdentifier(param, visit)
+		}
+		for _, d := range n.Defaults {
+			Walk(d, visit)
+		}
+		walkBlock(n.Body, visit)
+	case *CallExpression:
+		Walk(n.Function, visit)
+		for _, arg := range n.Arguments {
+			Walk(arg, visit)
+		}
+		for _, named := range n.Named {
+			Walk(named.Value, visit)
+		}
+	case *LengthExpression:
+		Walk(n.List, visit)
+	case *SliceExpression:
+		Walk(n.From, visit)
+		Walk(n.To, visit)
+		Walk(n.List, visit)
+	case *SplitExpression:
+		Walk(n.Text, visit)
+		Walk(n.Separator, visit)
+	case *JoinExpression:
+		Walk(n.List, visit)
+		Walk(n.Separator, visit)
+	case *LetterCaseExpression:
+		Walk(n.Text, visit)
+	case *TrimExpression:
+		Walk(n.Text, visit)
+	case *ReplaceExpression:
+		Walk(n.Old, visit)
+		walkPattern(n.Pattern, visit)
+		Walk(n.New, visit)
+		Walk(n.Text, visit)
+	case *Pattern:
+		Walk(n.Source, visit)
+	case *MatchExpression:
+		Walk(n.Text, visit)
+		walkPattern(n.Pattern, visit)
+	case *FindExpression:
+		walkPattern(n.Pattern, visit)
+		Walk(n.Text, visit)
+	case *PositionExpression:
+		Walk(n.Target, visit)
+		Walk(n.Source, visit)
+	case *CharactersExpression:
+		Walk(n.From, visit)
+		Walk(n.To, visit)
+		Walk(n.Text, visit)
+	case *RepeatedExpression:
+		Walk(n.Text, visit)
+		Walk(n.Count, visit)
+	case *PadExpression:
+		Walk(n.Text, visit)
+		Walk(n.Width, visit)
+		Walk(n.Fill, visit)
+	case *MemberExpression:
+		Walk(n.Module, visit)
+		walkIdentifier(n.Name, visit)
+	case *IndexExpression:
+		Walk(n.Index, visit)
+		Walk(n.List, visit)
+	case *NegativeExpression:
+		Walk(n.Value, visit)
+	case *BodyOfExpression:
+		Walk(n.Response, visit)
+	case *StatusOfExpression:
+		Walk(n.Response, visit)
+	case *HeaderFromExpression:
+		Walk(n.HeaderName, visit)
+		Walk(n.Response, visit)
+	case *FieldFromExpression:
+		Walk(n.FieldName, visit)
+		Walk(n.Source, visit)
+	case *MethodOfExpression:
+		Walk(n.Request, visit)
+	case *PathOfExpression:
+		Walk(n.Request, visit)
+	case *QueryFromExpression:
+		Walk(n.QueryName, visit)
+		Walk(n.Request, visit)
+	}
+}
+
+// walkBlock, walkIdentifier and walkPattern skip absent optional children,
+// which would otherwise reach Walk as non-nil interfaces holding nil pointers
+func walkBlock(block *BlockStatement, visit func(Node) bool) {
+	if block != nil {
+		Walk(block, visit)
+	}
+}
+
+func walkIdentifier(ident *Identifier, visit func(Node) bool) {
+	if ident != nil {
+		Walk(ident, visit)
+	}
+}
+
+func walkPattern(pattern *Pattern, visit func(Node) bool) {
+	if pattern != nil {
+		Walk(pattern, visit)
+	}
+}
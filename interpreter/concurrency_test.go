@@ -0,0 +1,103 @@
+package interpreter
+
+import (
+	"az-lang/object"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestNotesAPIConcurrentRequests runs examples/notes_api.abc and sends it
+// many requests at once. Run with -race to check the shared notes list is
+// safe; the final counts check that no update was lost.
+func TestNotesAPIConcurrentRequests(t *testing.T) {
+	source, err := os.ReadFile("../examples/notes_api.abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, env := serveScript(t, string(source))
+
+	const added = 100
+	do := func(method, path, body string) (int, string, error) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			return 0, "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		content, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(content), err
+	}
+
+	// run calls request for 0 to n-1 at the same time, along with as many
+	// reads of the notes
+	run := func(n int, request func(i int) (int, int, string, error)) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				want, status, body, err := request(i)
+				if err != nil {
+					t.Error(err)
+				} else if status != want {
+					t.Errorf("request %d: got status %d, want %d: %s", i, status, want, body)
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				if status, body, err := do("GET", "/notes", ""); err != nil {
+					t.Error(err)
+				} else if status != 200 {
+					t.Errorf("GET /notes: got status %d: %s", status, body)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	run(added, func(i int) (int, int, string, error) {
+		status, body, err := do("POST", "/notes", fmt.Sprintf(`{"note": "note %d"}`, i))
+		return 201, status, body, err
+	})
+
+	// Delete every even note
+	run(added, func(i int) (int, int, string, error) {
+		if i%2 == 1 {
+			status, body, err := do("GET", "/notes/count", "")
+			return 200, status, body, err
+		}
+		status, body, err := do("DELETE", "/notes?note="+url.QueryEscape(fmt.Sprintf("note %d", i)), "")
+		return 200, status, body, err
+	})
+
+	want := 1 + added/2
+	if _, body, err := do("GET", "/notes/count", ""); err != nil {
+		t.Fatal(err)
+	} else if body != fmt.Sprint(want) {
+		t.Errorf("GET /notes/count gave %s, want %d", body, want)
+	}
+
+	notes, _ := env.Get("notes")
+	list, ok := notes.(*object.List)
+	if !ok {
+		t.Fatalf("notes is %s, want a list", notes.Inspect())
+	}
+	if len(list.Elements) != want {
+		t.Errorf("notes has %d items, want %d", len(list.Elements), want)
+	}
+	for _, note := range list.Elements {
+		var n int
+		if _, err := fmt.Sscanf(note.Inspect(), "note %d", &n); err == nil && n%2 == 0 {
+			t.Errorf("%s was deleted but is still in notes", note.Inspect())
+		}
+	}
+}
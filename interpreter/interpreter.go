@@ -2,14 +2,24 @@ package interpreter
 
 import (
 	"az-lang/ast"
+	"az-lang/lexer"
 	"az-lang/object"
+	"az-lang/parser"
+	"az-lang/stdlib"
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,13 +29,28 @@ var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	// Loop control signals
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 var httpClient = &http.Client{
 	Timeout: 30 * time.Second,
 }
 
+// Eval evaluates node. A runtime error is stamped with the position of the
+// innermost node that produced it, so messages point at the failing code.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+	if err, ok := result.(*object.Error); ok && err.Line == 0 {
+		pos := node.Pos()
+		err.Line, err.Column = pos.Line, pos.Column
+	}
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -34,18 +59,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalBlockStatement(node, env)
 	case *ast.SetStatement:
 		return evalSetStatement(node, env)
+	case *ast.LetStatement:
+		return evalLetStatement(node, env)
+	case *ast.GlobalStatement:
+		// Resolved when parsing; nothing to do at run time
+		return NULL
 	case *ast.IncreaseStatement:
 		return evalIncreaseStatement(node, env)
 	case *ast.DecreaseStatement:
 		return evalDecreaseStatement(node, env)
 	case *ast.IfStatement:
 		return evalIfStatement(node, env)
+	case *ast.CheckStatement:
+		return evalCheckStatement(node, env)
 	case *ast.WhileStatement:
 		return evalWhileStatement(node, env)
+	case *ast.RepeatStatement:
+		return evalRepeatStatement(node, env)
+	case *ast.ForRangeStatement:
+		return evalForRangeStatement(node, env)
+	case *ast.StopLoopStatement:
+		return BREAK
+	case *ast.SkipStatement:
+		return CONTINUE
 	case *ast.ForStatement:
 		return evalForStatement(node, env)
 	case *ast.FunctionDefinition:
 		return evalFunctionDefinition(node, env)
+	case *ast.FunctionLiteral:
+		return evalFunctionLiteral(node, env)
+	case *ast.ExpressionStatement:
+		return Eval(node.Expression, env)
 	case *ast.ReturnStatement:
 		return evalReturnStatement(node, env)
 	case *ast.SayStatement:
@@ -54,12 +98,35 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalAskStatement(node, env)
 	case *ast.AppendStatement:
 		return evalAppendStatement(node, env)
+	case *ast.SetKeyStatement:
+		return evalSetKeyStatement(node, env)
+	case *ast.RemoveStatement:
+		return evalRemoveStatement(node, env)
+	case *ast.SetItemStatement:
+		return evalSetItemStatement(node, env)
+	case *ast.InsertStatement:
+		return evalInsertStatement(node, env)
+	case *ast.PopStatement:
+		return evalPopStatement(node, env)
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+	case *ast.RaiseStatement:
+		return evalRaiseStatement(node, env)
+	case *ast.UseStatement:
+		return evalUseStatement(node, env)
+	case *ast.ExportStatement:
+		// Collected once the module has run; nothing to do at run time
+		return NULL
 
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.BooleanLiteral:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.Identifier:
@@ -68,6 +135,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalNegativeExpression(node, env)
 	case *ast.ListLiteral:
 		return evalListLiteral(node, env)
+	case *ast.DictionaryLiteral:
+		return evalDictionaryLiteral(node, env)
+	case *ast.KeysOfExpression:
+		return evalKeysOfExpression(node, env)
+	case *ast.ValuesOfExpression:
+		return evalValuesOfExpression(node, env)
 	case *ast.ComparisonExpression:
 		return evalComparisonExpression(node, env)
 	case *ast.LogicalExpression:
@@ -80,6 +153,54 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalLengthExpression(node, env)
 	case *ast.IndexExpression:
 		return evalIndexExpression(node, env)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+	case *ast.SplitExpression:
+		return evalSplitExpression(node, env)
+	case *ast.JoinExpression:
+		return evalJoinExpression(node, env)
+	case *ast.LetterCaseExpression:
+		return evalLetterCaseExpression(node, env)
+	case *ast.TrimExpression:
+		return evalTrimExpression(node, env)
+	case *ast.ReplaceExpression:
+		return evalReplaceExpression(node, env)
+	case *ast.PositionExpression:
+		return evalPositionExpression(node, env)
+	case *ast.CharactersExpression:
+		return evalCharactersExpression(node, env)
+	case *ast.RepeatedExpression:
+		return evalRepeatedExpression(node, env)
+	case *ast.PadExpression:
+		return evalPadExpression(node, env)
+	case *ast.MemberExpression:
+		return evalMemberExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+	case *ast.FindExpression:
+		return evalFindExpression(node, env)
+	case *ast.ConversionExpression:
+		return evalConversionExpression(node, env)
+	case *ast.TypeCheckExpression:
+		return evalTypeCheckExpression(node, env)
+	case *ast.TypeOfExpression:
+		return evalTypeOfExpression(node, env)
+	case *ast.WhereExpression:
+		return evalWhereExpression(node, env)
+	case *ast.TransformExpression:
+		return evalTransformExpression(node, env)
+	case *ast.SortExpression:
+		return evalSortExpression(node, env)
+	case *ast.AggregateExpression:
+		return evalAggregateExpression(node, env)
+	case *ast.ReduceExpression:
+		return evalReduceExpression(node, env)
+	case *ast.ReverseExpression:
+		return evalReverseExpression(node, env)
+	case *ast.UniqueExpression:
+		return evalUniqueExpression(node, env)
+	case *ast.TakeExpression:
+		return evalTakeExpression(node, env)
 
 	// HTTP Statements
 	case *ast.FetchStatement:
@@ -158,7 +279,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.REPLY_VALUE_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -169,73 +291,90 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 func evalSetStatement(ss *ast.SetStatement, env *object.Environment) object.Object {
 	val := Eval(ss.Value, env)
-	if isError(val) {
+	if isInterrupt(val) {
 		return val
 	}
-	env.Set(ss.Name.Value, val)
+	assign(env, ss.Name, val)
 	return val
 }
 
-func evalIncreaseStatement(is *ast.IncreaseStatement, env *object.Environment) object.Object {
-	currentVal, ok := env.Get(is.Target.Value)
-	if !ok {
-		return newError("undefined variable: %s", is.Target.Value)
+func evalLetStatement(ls *ast.LetStatement, env *object.Environment) object.Object {
+	val := Eval(ls.Value, env)
+	if isInterrupt(val) {
+		return val
 	}
+	assign(env, ls.Name, val)
+	return val
+}
 
-	currentInt, ok := currentVal.(*object.Integer)
-	if !ok {
-		return newError("increase requires an integer variable, got %s", currentVal.Type())
-	}
+// assign stores val in the scope the resolver chose for target
+func assign(env *object.Environment, target *ast.Identifier, val object.Object) {
+	env.Ancestor(target.Depth).Set(target.Value, val)
+}
 
+func evalIncreaseStatement(is *ast.IncreaseStatement, env *object.Environment) object.Object {
 	amount := Eval(is.Amount, env)
-	if isError(amount) {
+	if isInterrupt(amount) {
 		return amount
 	}
 
-	amountInt, ok := amount.(*object.Integer)
-	if !ok {
-		return newError("increase amount must be an integer, got %s", amount.Type())
+	if !isNumber(amount) {
+		return newError("increase amount must be a number, got %s", amount.Type())
 	}
 
-	result := &object.Integer{Value: currentInt.Value + amountInt.Value}
-	env.Set(is.Target.Value, result)
-	return result
-}
-
-func evalDecreaseStatement(ds *ast.DecreaseStatement, env *object.Environment) object.Object {
-	currentVal, ok := env.Get(ds.Target.Value)
+	// Read and write under one lock so concurrent handlers don't lose updates
+	result, ok := env.Ancestor(is.Target.Depth).Update(is.Target.Value, func(currentVal object.Object) object.Object {
+		if !isNumber(currentVal) {
+			return newError("increase requires a number variable, got %s", currentVal.Type())
+		}
+		return evalNumberArithmetic("plus", currentVal, amount)
+	})
 	if !ok {
-		return newError("undefined variable: %s", ds.Target.Value)
+		return missingTarget(is.Target.Value, env)
 	}
+	return result
+}
 
-	currentInt, ok := currentVal.(*object.Integer)
-	if !ok {
-		return newError("decrease requires an integer variable, got %s", currentVal.Type())
+// missingTarget reports a variable that increase or decrease could not find
+// to change
+func missingTarget(name string, env *object.Environment) object.Object {
+	if _, ok := env.Get(name); ok {
+		return newError("%s comes from a module, so only the module can change it", name)
 	}
+	return newKindError(nameErrorKind, "undefined variable: %s", name)
+}
 
+func evalDecreaseStatement(ds *ast.DecreaseStatement, env *object.Environment) object.Object {
 	amount := Eval(ds.Amount, env)
-	if isError(amount) {
+	if isInterrupt(amount) {
 		return amount
 	}
 
-	amountInt, ok := amount.(*object.Integer)
-	if !ok {
-		return newError("decrease amount must be an integer, got %s", amount.Type())
+	if !isNumber(amount) {
+		return newError("decrease amount must be a number, got %s", amount.Type())
 	}
 
-	result := &object.Integer{Value: currentInt.Value - amountInt.Value}
-	env.Set(ds.Target.Value, result)
+	// Read and write under one lock so concurrent handlers don't lose updates
+	result, ok := env.Ancestor(ds.Target.Depth).Update(ds.Target.Value, func(currentVal object.Object) object.Object {
+		if !isNumber(currentVal) {
+			return newError("decrease requires a number variable, got %s", currentVal.Type())
+		}
+		return evalNumberArithmetic("minus", currentVal, amount)
+	})
+	if !ok {
+		return missingTarget(ds.Target.Value, env)
+	}
 	return result
 }
 
 func evalArithmeticExpression(ae *ast.ArithmeticExpression, env *object.Environment) object.Object {
 	left := Eval(ae.Left, env)
-	if isError(left) {
+	if isInterrupt(left) {
 		return left
 	}
 
 	right := Eval(ae.Right, env)
-	if isError(right) {
+	if isInterrupt(right) {
 		return right
 	}
 
@@ -260,67 +399,112 @@ func evalArithmeticExpression(ae *ast.ArithmeticExpression, env *object.Environm
 		}
 	}
 
-	leftVal, ok := left.(*object.Integer)
-	if !ok {
-		return newError("arithmetic operations require integers, got %s", left.Type())
+	if !isNumber(left) {
+		return newError("arithmetic operations require numbers, got %s", left.Type())
 	}
 
-	rightVal, ok := right.(*object.Integer)
-	if !ok {
-		return newError("arithmetic operations require integers, got %s", right.Type())
+	if !isNumber(right) {
+		return newError("arithmetic operations require numbers, got %s", right.Type())
 	}
 
-	var result int64
-	switch ae.Operator {
+	return evalNumberArithmetic(ae.Operator, left, right)
+}
+
+// evalNumberArithmetic applies an arithmetic operator to two numbers.
+// Two integers stay integers (division truncates); if either side is a
+// decimal the result is a decimal.
+func evalNumberArithmetic(operator string, left, right object.Object) object.Object {
+	leftInt, leftIsInt := left.(*object.Integer)
+	rightInt, rightIsInt := right.(*object.Integer)
+
+	if leftIsInt && rightIsInt {
+		var result int64
+		switch operator {
+		case "plus":
+			result = leftInt.Value + rightInt.Value
+		case "minus":
+			result = leftInt.Value - rightInt.Value
+		case "times":
+			result = leftInt.Value * rightInt.Value
+		case "divided":
+			if rightInt.Value == 0 {
+				return newKindError(mathErrorKind, "division by zero")
+			}
+			result = leftInt.Value / rightInt.Value
+		}
+		return &object.Integer{Value: result}
+	}
+
+	leftVal, _ := toFloat(left)
+	rightVal, _ := toFloat(right)
+
+	var result float64
+	switch operator {
 	case "plus":
-		result = leftVal.Value + rightVal.Value
+		result = leftVal + rightVal
 	case "minus":
-		result = leftVal.Value - rightVal.Value
+		result = leftVal - rightVal
 	case "times":
-		result = leftVal.Value * rightVal.Value
+		result = leftVal * rightVal
 	case "divided":
-		if rightVal.Value == 0 {
-			return newError("division by zero")
+		if rightVal == 0 {
+			return newKindError(mathErrorKind, "division by zero")
 		}
-		result = leftVal.Value / rightVal.Value
+		result = leftVal / rightVal
 	}
+	return &object.Float{Value: result}
+}
 
-	return &object.Integer{Value: result}
+func evalInterpolatedString(is *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range is.Parts {
+		val := Eval(part, env)
+		if isInterrupt(val) {
+			return val
+		}
+		// Strings are inserted as-is, everything else as it would be said
+		if str, ok := val.(*object.String); ok {
+			out.WriteString(str.Value)
+		} else {
+			out.WriteString(val.Inspect())
+		}
+	}
+	return &object.String{Value: out.String()}
 }
 
 func evalLogicalExpression(le *ast.LogicalExpression, env *object.Environment) object.Object {
 	switch le.Operator {
 	case "not":
 		right := Eval(le.Right, env)
-		if isError(right) {
+		if isInterrupt(right) {
 			return right
 		}
 		return nativeBoolToBooleanObject(!isTruthy(right))
 
 	case "and":
 		left := Eval(le.Left, env)
-		if isError(left) {
+		if isInterrupt(left) {
 			return left
 		}
 		if !isTruthy(left) {
 			return FALSE
 		}
 		right := Eval(le.Right, env)
-		if isError(right) {
+		if isInterrupt(right) {
 			return right
 		}
 		return nativeBoolToBooleanObject(isTruthy(right))
 
 	case "or":
 		left := Eval(le.Left, env)
-		if isError(left) {
+		if isInterrupt(left) {
 			return left
 		}
 		if isTruthy(left) {
 			return TRUE
 		}
 		right := Eval(le.Right, env)
-		if isError(right) {
+		if isInterrupt(right) {
 			return right
 		}
 		return nativeBoolToBooleanObject(isTruthy(right))
@@ -331,7 +515,7 @@ func evalLogicalExpression(le *ast.LogicalExpression, env *object.Environment) o
 
 func evalIfStatement(is *ast.IfStatement, env *object.Environment) object.Object {
 	condition := Eval(is.Condition, env)
-	if isError(condition) {
+	if isInterrupt(condition) {
 		return condition
 	}
 
@@ -343,12 +527,62 @@ func evalIfStatement(is *ast.IfStatement, env *object.Environment) object.Object
 	return NULL
 }
 
+// evalCheckStatement evaluates the subject once, then runs the first arm
+// with a matching value or range
+func evalCheckStatement(cs *ast.CheckStatement, env *object.Environment) object.Object {
+	subject := Eval(cs.Subject, env)
+	if isInterrupt(subject) {
+		return subject
+	}
+
+	for _, c := range cs.Cases {
+		for _, match := range c.Matches {
+			matched, errObj := checkMatches(subject, match, env)
+			if errObj != nil {
+				return errObj
+			}
+			if matched {
+				return Eval(c.Body, env)
+			}
+		}
+	}
+
+	if cs.Otherwise != nil {
+		return Eval(cs.Otherwise, env)
+	}
+	return NULL
+}
+
+func checkMatches(subject object.Object, match ast.CheckMatch, env *object.Environment) (bool, object.Object) {
+	value := Eval(match.Value, env)
+	if isInterrupt(value) {
+		return false, value
+	}
+
+	if match.To == nil {
+		return evalEquals(subject, value) == TRUE, nil
+	}
+
+	to := Eval(match.To, env)
+	if isInterrupt(to) {
+		return false, to
+	}
+
+	if !isNumber(value) || !isNumber(to) {
+		return false, newError("check ranges require numbers, got %s to %s", value.Type(), to.Type())
+	}
+	if !isNumber(subject) {
+		return false, nil
+	}
+	return compareNumbers(subject, value) >= 0 && compareNumbers(subject, to) <= 0, nil
+}
+
 func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
 	var result object.Object = NULL
 
 	for {
 		condition := Eval(ws.Condition, env)
-		if isError(condition) {
+		if isInterrupt(condition) {
 			return condition
 		}
 
@@ -356,12 +590,183 @@ func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.
 			break
 		}
 
-		result = Eval(ws.Body, env)
-		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result
+		body := Eval(ws.Body, env)
+		if exit, done := loopExit(body); done {
+			return exit
+		}
+		result = loopResult(body, result)
+	}
+
+	return result
+}
+
+// iteration is a snapshot of a collection's contents for "for each".
+// Keys are positions counting from 1 for lists, strings and json arrays,
+// and names for dictionaries and json objects.
+type iteration struct {
+	keys   []object.Object
+	values []object.Object
+	byKey  bool // a single loop variable receives the keys, not the values
+}
+
+// iterate is the iteration protocol: every collection type that "for each"
+// can loop over is handled here. Taking a snapshot first means the loop
+// body can change the collection without affecting the loop.
+func iterate(collection object.Object) (*iteration, bool) {
+	items := &iteration{}
+
+	switch c := collection.(type) {
+	case *object.List:
+		items.values = c.Snapshot()
+	case *object.String:
+		for _, char := range object.Graphemes(c.Value) {
+			items.values = append(items.values, &object.String{Value: char})
+		}
+	case *object.Dictionary:
+		keys, values := c.Entries()
+		for _, key := range keys {
+			items.keys = append(items.keys, &object.String{Value: key})
+		}
+		items.values = values
+		items.byKey = true
+	case *object.Json:
+		switch v := c.Value.(type) {
+		case []interface{}:
+			for _, elem := range v {
+				items.values = append(items.values, interfaceToObject(elem))
+			}
+		case map[string]interface{}:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				items.keys = append(items.keys, &object.String{Value: name})
+				items.values = append(items.values, interfaceToObject(v[name]))
+			}
+			items.byKey = true
+		default:
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if items.keys == nil {
+		for i := range items.values {
+			items.keys = append(items.keys, &object.Integer{Value: int64(i + 1)})
+		}
+	}
+	return items, true
+}
+
+// loopExit reports whether a pass through a loop body ends the loop, and
+// if so what the loop returns: NULL for "stop the loop", or the return,
+// reply or error that interrupted it
+func loopExit(body object.Object) (object.Object, bool) {
+	if body == nil {
+		return nil, false
+	}
+	switch body.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ:
+		return body, true
+	}
+	if isInterrupt(body) {
+		return body, true
+	}
+	return nil, false
+}
+
+// loopResult keeps the value of the last body that ran to its end
+func loopResult(body, previous object.Object) object.Object {
+	if body == nil || body.Type() == object.CONTINUE_OBJ {
+		return previous
+	}
+	return body
+}
+
+// evalRepeatStatement runs the body a fixed number of times
+func evalRepeatStatement(rs *ast.RepeatStatement, env *object.Environment) object.Object {
+	countObj := Eval(rs.Count, env)
+	if isInterrupt(countObj) {
+		return countObj
+	}
+
+	count, ok := countObj.(*object.Integer)
+	if !ok {
+		return newError("repeat count must be a whole number, got %s", countObj.Type())
+	}
+
+	var result object.Object = NULL
+	for i := int64(0); i < count.Value; i++ {
+		body := Eval(rs.Body, env)
+		if exit, done := loopExit(body); done {
+			return exit
+		}
+		result = loopResult(body, result)
+	}
+
+	return result
+}
+
+// evalForRangeStatement counts from one number to another, computing each
+// value as it goes rather than building a list
+func evalForRangeStatement(fr *ast.ForRangeStatement, env *object.Environment) object.Object {
+	from := Eval(fr.From, env)
+	if isInterrupt(from) {
+		return from
+	}
+	to := Eval(fr.To, env)
+	if isInterrupt(to) {
+		return to
+	}
+	if !isNumber(from) || !isNumber(to) {
+		return newError("for each ... from ... to requires numbers, got %s and %s", from.Type(), to.Type())
+	}
+
+	// Without "by", count up or down towards the end
+	var step object.Object = &object.Integer{Value: 1}
+	if compareNumbers(from, to) > 0 {
+		step = &object.Integer{Value: -1}
+	}
+	if fr.Step != nil {
+		step = Eval(fr.Step, env)
+		if isInterrupt(step) {
+			return step
+		}
+		if !isNumber(step) {
+			return newError("for each ... by requires a number, got %s", step.Type())
+		}
+	}
+
+	direction := compareNumbers(step, &object.Integer{Value: 0})
+	if direction == 0 {
+		return newError("for each ... by must not be zero")
+	}
+
+	var result object.Object = NULL
+	for i := int64(0); ; i++ {
+		// Multiply rather than add up steps, so decimal steps don't drift
+		offset := evalNumberArithmetic("times", &object.Integer{Value: i}, step)
+		current := evalNumberArithmetic("plus", from, offset)
+		if compareNumbers(current, to) == direction {
+			// Allow for rounding, so 0 to 0.3 by 0.1 still ends on 0.3
+			if !closeTo(current, to) {
+				break
 			}
+			current = to
+		}
+		passEnv := object.NewEnclosedEnvironment(env)
+		passEnv.Set(fr.Variable.Value, current)
+
+		body := Eval(fr.Body, passEnv)
+		if exit, done := loopExit(body); done {
+			return exit
 		}
+		result = loopResult(body, result)
 	}
 
 	return result
@@ -369,25 +774,35 @@ func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.
 
 func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
 	iterable := Eval(fs.Iterable, env)
-	if isError(iterable) {
+	if isInterrupt(iterable) {
 		return iterable
 	}
 
-	list, ok := iterable.(*object.List)
+	items, ok := iterate(iterable)
 	if !ok {
-		return newError("for each requires a list, got %s", iterable.Type())
+		return newError("for each requires a list, string, dictionary or json, got %s", iterable.Type())
 	}
 
 	var result object.Object = NULL
 
-	for _, element := range list.Elements {
-		env.Set(fs.Variable.Value, element)
-		result = Eval(fs.Body, env)
-		if result != nil {
-			if result.Type() == object.RETURN_VALUE_OBJ || result.Type() == object.ERROR_OBJ {
-				return result
-			}
+	for i := range items.values {
+		// Each pass binds the loop variables afresh, so functions created
+		// in the body keep the values from their own pass
+		passEnv := object.NewEnclosedEnvironment(env)
+		if fs.Value != nil {
+			passEnv.Set(fs.Variable.Value, items.keys[i])
+			passEnv.Set(fs.Value.Value, items.values[i])
+		} else if items.byKey {
+			passEnv.Set(fs.Variable.Value, items.keys[i])
+		} else {
+			passEnv.Set(fs.Variable.Value, items.values[i])
+		}
+
+		body := Eval(fs.Body, passEnv)
+		if exit, done := loopExit(body); done {
+			return exit
 		}
+		result = loopResult(body, result)
 	}
 
 	return result
@@ -395,163 +810,1643 @@ func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Obje
 
 func evalFunctionDefinition(fd *ast.FunctionDefinition, env *object.Environment) object.Object {
 	fn := &object.Function{
+		Name:       fd.Name.Value,
 		Parameters: fd.Parameters,
+		Defaults:   fd.Defaults,
 		Body:       fd.Body,
 		Env:        env,
+		Line:       fd.Token.Line,
+	}
+	env.Set(fd.Name.Value, fn)
+	return fn
+}
+
+// evalFunctionLiteral creates a function that closes over the environment
+// it is written in
+func evalFunctionLiteral(fl *ast.FunctionLiteral, env *object.Environment) object.Object {
+	return &object.Function{
+		Parameters: fl.Parameters,
+		Defaults:   fl.Defaults,
+		Body:       fl.Body,
+		Env:        env,
+		Line:       fl.Token.Line,
+	}
+}
+
+// evalFunctionValue evaluates the function part of a call or route. An
+// unknown name is reported as a missing function rather than a missing
+// variable.
+func evalFunctionValue(node ast.Expression, env *object.Environment) (*object.Function, object.Object) {
+	var fnObj object.Object
+	if ident, ok := node.(*ast.Identifier); ok {
+		val, ok := env.Get(ident.Value)
+		if !ok {
+			return nil, newKindError(nameErrorKind, "function not defined: %s", ident.Value)
+		}
+		fnObj = val
+	} else {
+		fnObj = Eval(node, env)
+		if isInterrupt(fnObj) {
+			return nil, fnObj
+		}
+	}
+
+	fn, ok := fnObj.(*object.Function)
+	if !ok {
+		return nil, newError("%s is not a function", node.String())
+	}
+	return fn, nil
+}
+
+func evalCallExpression(ce *ast.CallExpression, env *object.Environment) object.Object {
+	fn, errObj := evalFunctionValue(ce.Function, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	// Evaluate arguments
+	args := []object.Object{}
+	for _, arg := range ce.Arguments {
+		evaluated := Eval(arg, env)
+		if isInterrupt(evaluated) {
+			return evaluated
+		}
+		args = append(args, evaluated)
+	}
+
+	named := map[string]object.Object{}
+	for _, arg := range ce.Named {
+		if _, seen := named[arg.Name.Value]; seen {
+			return newError("%s was given %s twice (defined at line %d)", functionName(fn), arg.Name.Value, fn.Line)
+		}
+		evaluated := Eval(arg.Value, env)
+		if isInterrupt(evaluated) {
+			return evaluated
+		}
+		named[arg.Name.Value] = evaluated
+	}
+
+	callEnv, bindErr := bindArguments(fn, args, named)
+	if bindErr != nil {
+		return bindErr
+	}
+
+	result := runFunction(fn, callEnv)
+
+	if err, ok := result.(*object.Error); ok {
+		err.Stack = append(err.Stack, object.StackFrame{Function: functionName(fn), Line: ce.Token.Line})
+	}
+
+	return result
+}
+
+// applyFunction runs fn with args bound to its parameters in order
+func applyFunction(fn *object.Function, args []object.Object) object.Object {
+	callEnv, errObj := bindArguments(fn, args, nil)
+	if errObj != nil {
+		return errObj
+	}
+	return runFunction(fn, callEnv)
+}
+
+// bindArguments creates the scope for a call of fn, inside the one the
+// function was defined in. Positional arguments fill parameters in order
+// and named ones fill them by name; parameters left over take their
+// defaults, which can refer to the parameters before them.
+func bindArguments(fn *object.Function, args []object.Object, named map[string]object.Object) (*object.Environment, *object.Error) {
+	required := 0
+	for i := range fn.Parameters {
+		if i >= len(fn.Defaults) || fn.Defaults[i] == nil {
+			required++
+		}
+	}
+
+	if len(args) > len(fn.Parameters) {
+		return nil, arityError(fn, required, len(args))
+	}
+
+	for name := range named {
+		if !hasParameter(fn, name) {
+			return nil, newError("%s has no parameter called %s (defined at line %d)", functionName(fn), name, fn.Line)
+		}
+	}
+
+	callEnv := object.NewEnclosedEnvironment(fn.Env)
+	given := len(args) + len(named)
+
+	for i, param := range fn.Parameters {
+		if i < len(args) {
+			if _, ok := named[param.Value]; ok {
+				return nil, newError("%s was given %s twice (defined at line %d)", functionName(fn), param.Value, fn.Line)
+			}
+			callEnv.Set(param.Value, args[i])
+			continue
+		}
+		if val, ok := named[param.Value]; ok {
+			callEnv.Set(param.Value, val)
+			continue
+		}
+		if i >= len(fn.Defaults) || fn.Defaults[i] == nil {
+			if len(named) == 0 {
+				return nil, arityError(fn, required, given)
+			}
+			return nil, newError("%s is missing a value for %s (defined at line %d)", functionName(fn), param.Value, fn.Line)
+		}
+		val := Eval(fn.Defaults[i], callEnv)
+		if err, ok := val.(*object.Error); ok {
+			return nil, err
+		}
+		callEnv.Set(param.Value, val)
+	}
+
+	return callEnv, nil
+}
+
+// runFunction executes fn's body in the scope bindArguments created
+func runFunction(fn *object.Function, callEnv *object.Environment) object.Object {
+	result := Eval(fn.Body, callEnv)
+
+	// Errors in a function from another module point into that file
+	if err, ok := result.(*object.Error); ok && err.File == "" {
+		err.File = fn.Env.File()
+	}
+
+	// Unwrap return value
+	if returnValue, ok := result.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return result
+}
+
+func arityError(fn *object.Function, required int, given int) *object.Error {
+	expected := fmt.Sprintf("%d", required)
+	if required < len(fn.Parameters) {
+		expected = fmt.Sprintf("%d to %d", required, len(fn.Parameters))
+	}
+	noun := "arguments"
+	if expected == "1" {
+		noun = "argument"
+	}
+	return newError("%s takes %s %s but was given %d (defined at line %d)",
+		functionName(fn), expected, noun, given, fn.Line)
+}
+
+func hasParameter(fn *object.Function, name string) bool {
+	for _, param := range fn.Parameters {
+		if param.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+// functionName names fn in error messages and stack traces
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "a function"
+	}
+	return fn.Name
+}
+
+func evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) object.Object {
+	if rs.ReturnValue == nil {
+		return &object.ReturnValue{Value: NULL}
+	}
+
+	val := Eval(rs.ReturnValue, env)
+	if isInterrupt(val) {
+		return val
+	}
+	return &object.ReturnValue{Value: val}
+}
+
+func evalSayStatement(ss *ast.SayStatement, env *object.Environment) object.Object {
+	val := Eval(ss.Value, env)
+	if isInterrupt(val) {
+		return val
+	}
+	fmt.Println(val.Inspect())
+	return NULL
+}
+
+func evalAskStatement(as *ast.AskStatement, env *object.Environment) object.Object {
+	reader := bufio.NewReader(os.Stdin)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return newError("error reading input: %s", err)
+	}
+
+	// Remove newline
+	if len(input) > 0 && input[len(input)-1] == '\n' {
+		input = input[:len(input)-1]
+	}
+	if len(input) > 0 && input[len(input)-1] == '\r' {
+		input = input[:len(input)-1]
+	}
+
+	result := &object.String{Value: input}
+	assign(env, as.Target, result)
+	return result
+}
+
+func evalLengthExpression(le *ast.LengthExpression, env *object.Environment) object.Object {
+	val := Eval(le.List, env)
+	if isInterrupt(val) {
+		return val
+	}
+
+	switch v := val.(type) {
+	case *object.List:
+		return &object.Integer{Value: int64(v.Len())}
+	case *object.String:
+		return &object.Integer{Value: int64(len(object.Graphemes(v.Value)))}
+	case *object.Dictionary:
+		return &object.Integer{Value: int64(v.Len())}
+	default:
+		return newError("length requires a list, string or dictionary, got %s", val.Type())
+	}
+}
+
+func evalIndexExpression(ie *ast.IndexExpression, env *object.Environment) object.Object {
+	index := Eval(ie.Index, env)
+	if isInterrupt(index) {
+		return index
+	}
+
+	list := Eval(ie.List, env)
+	if isInterrupt(list) {
+		return list
+	}
+
+	i, errObj := zeroBased(index)
+	if errObj != nil {
+		return errObj
+	}
+
+	switch l := list.(type) {
+	case *object.List:
+		elem, ok := l.At(i)
+		if !ok {
+			return newError("index out of bounds: %s (list has %d elements)", index.Inspect(), l.Len())
+		}
+		return elem
+	case *object.String:
+		chars := object.Graphemes(l.Value)
+		if i < 0 {
+			i += len(chars)
+		}
+		if i < 0 || i >= len(chars) {
+			return newError("index out of bounds: %s (string has %d characters)", index.Inspect(), len(chars))
+		}
+		return &object.String{Value: chars[i]}
+	default:
+		return newError("indexing requires a list or string, got %s", list.Type())
+	}
+}
+
+// zeroBased converts a 1-based position to the index the list methods take.
+// Negative positions count back from the end and pass through unchanged,
+// so -1 is the last item.
+func zeroBased(position object.Object) (int, object.Object) {
+	n, ok := position.(*object.Integer)
+	if !ok {
+		return 0, newError("index must be an integer, got %s", position.Type())
+	}
+	if n.Value == 0 {
+		return 0, newError("index out of bounds: 0 (the first item is item 1)")
+	}
+	if n.Value > 0 {
+		return int(n.Value - 1), nil
+	}
+	return int(n.Value), nil
+}
+
+// targetList looks up the list a statement changes in place
+func targetList(target *ast.Identifier, env *object.Environment, operation string) (*object.List, object.Object) {
+	obj, ok := env.Get(target.Value)
+	if !ok {
+		return nil, newKindError(nameErrorKind, "undefined variable: %s", target.Value)
+	}
+	list, ok := obj.(*object.List)
+	if !ok {
+		return nil, newError("%s requires a list, got %s", operation, obj.Type())
+	}
+	return list, nil
+}
+
+// evalSliceExpression returns the items between two positions, inclusive
+func evalSliceExpression(se *ast.SliceExpression, env *object.Environment) object.Object {
+	from := Eval(se.From, env)
+	if isInterrupt(from) {
+		return from
+	}
+	to := Eval(se.To, env)
+	if isInterrupt(to) {
+		return to
+	}
+
+	start, errObj := zeroBased(from)
+	if errObj != nil {
+		return errObj
+	}
+	end, errObj := zeroBased(to)
+	if errObj != nil {
+		return errObj
+	}
+
+	items, errObj := evalListOperand(se.List, env, "items ... to")
+	if errObj != nil {
+		return errObj
+	}
+
+	start, end, ok := sliceRange(start, end, len(items))
+	if !ok {
+		return newError("items %s to %s out of bounds (list has %d elements)", from.Inspect(), to.Inspect(), len(items))
+	}
+
+	sliced := make([]object.Object, end-start)
+	copy(sliced, items[start:end])
+	return &object.List{Elements: sliced}
+}
+
+// sliceRange turns the zero-based indexes of the first and last item
+// wanted into the bounds of a Go slice of a sequence of the given length.
+// A range that ends before it starts is empty.
+func sliceRange(first, last, length int) (int, int, bool) {
+	if first < 0 {
+		first += length
+	}
+	if last < 0 {
+		last += length
+	}
+	if first < 0 || first >= length || last < 0 || last >= length {
+		return 0, 0, false
+	}
+	if first > last {
+		return first, first, true
+	}
+	return first, last + 1, true
+}
+
+func evalSetItemStatement(si *ast.SetItemStatement, env *object.Environment) object.Object {
+	position := Eval(si.Position, env)
+	if isInterrupt(position) {
+		return position
+	}
+	i, errObj := zeroBased(position)
+	if errObj != nil {
+		return errObj
+	}
+
+	list, errObj := targetList(si.Target, env, "set item")
+	if errObj != nil {
+		return errObj
+	}
+
+	value := Eval(si.Value, env)
+	if isInterrupt(value) {
+		return value
+	}
+
+	if !list.SetAt(i, value) {
+		return newError("index out of bounds: %s (list has %d elements)", position.Inspect(), list.Len())
+	}
+	return value
+}
+
+// evalInsertStatement places a value before the item at a position, or
+// after the last item when the position is one past the end
+func evalInsertStatement(is *ast.InsertStatement, env *object.Environment) object.Object {
+	value := Eval(is.Value, env)
+	if isInterrupt(value) {
+		return value
+	}
+
+	position := Eval(is.Position, env)
+	if isInterrupt(position) {
+		return position
+	}
+	i, errObj := zeroBased(position)
+	if errObj != nil {
+		return errObj
+	}
+
+	list, errObj := targetList(is.Target, env, "insert")
+	if errObj != nil {
+		return errObj
+	}
+
+	if !list.Insert(i, value) {
+		return newError("insert position out of bounds: %s (list has %d elements, so positions go from 1 to %d)",
+			position.Inspect(), list.Len(), list.Len()+1)
+	}
+	return NULL
+}
+
+// evalPopStatement removes an item, the last one unless a position is
+// given, and stores it if the statement names a variable
+func evalPopStatement(ps *ast.PopStatement, env *object.Environment) object.Object {
+	i := -1
+	var position object.Object = &object.Integer{Value: -1}
+	if ps.Position != nil {
+		position = Eval(ps.Position, env)
+		if isInterrupt(position) {
+			return position
+		}
+		var errObj object.Object
+		i, errObj = zeroBased(position)
+		if errObj != nil {
+			return errObj
+		}
+	}
+
+	list, errObj := targetList(ps.Target, env, "pop")
+	if errObj != nil {
+		return errObj
+	}
+
+	val, ok := list.RemoveAt(i)
+	if !ok {
+		if ps.Position == nil {
+			return newError("cannot pop from an empty list: %s", ps.Target.Value)
+		}
+		return newError("index out of bounds: %s (list has %d elements)", position.Inspect(), list.Len())
+	}
+
+	if ps.Into != nil {
+		assign(env, ps.Into, val)
+	}
+	return val
+}
+
+func evalAppendStatement(as *ast.AppendStatement, env *object.Environment) object.Object {
+	value := Eval(as.Value, env)
+	if isInterrupt(value) {
+		return value
+	}
+
+	listObj, ok := env.Get(as.List.Value)
+	if !ok {
+		return newKindError(nameErrorKind, "undefined variable: %s", as.List.Value)
+	}
+
+	list, ok := listObj.(*object.List)
+	if !ok {
+		return newError("append requires a list, got %s", listObj.Type())
+	}
+
+	list.Append(value)
+	return NULL
+}
+
+// List operations. Each works on a list or a JSON array and returns a new
+// list, leaving the original unchanged. Operations that take a function
+// accept a named function or an inline one.
+
+// evalListOperand evaluates the list an operation works on
+func evalListOperand(node ast.Expression, env *object.Environment, operation string) ([]object.Object, object.Object) {
+	val := Eval(node, env)
+	if isInterrupt(val) {
+		return nil, val
+	}
+
+	items, ok := listItems(val)
+	if !ok {
+		return nil, newError("%s requires a list, got %s", operation, val.Type())
+	}
+	return items, nil
+}
+
+// listItems returns the items of a list or JSON array
+func listItems(obj object.Object) ([]object.Object, bool) {
+	switch obj.(type) {
+	case *object.List, *object.Json:
+		items, ok := iterate(obj)
+		if !ok || items.byKey {
+			return nil, false
+		}
+		return items.values, true
+	}
+	return nil, false
+}
+
+func evalWhereExpression(we *ast.WhereExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(we.List, env, "where")
+	if errObj != nil {
+		return errObj
+	}
+	fn, errObj := evalFunctionValue(we.Condition, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	kept := []object.Object{}
+	for _, item := range items {
+		keep := applyFunction(fn, []object.Object{item})
+		if isInterrupt(keep) {
+			return keep
+		}
+		if isTruthy(keep) {
+			kept = append(kept, item)
+		}
+	}
+	return &object.List{Elements: kept}
+}
+
+func evalTransformExpression(te *ast.TransformExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(te.List, env, "transformed by")
+	if errObj != nil {
+		return errObj
+	}
+	fn, errObj := evalFunctionValue(te.Function, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	results := make([]object.Object, 0, len(items))
+	for _, item := range items {
+		result := applyFunction(fn, []object.Object{item})
+		if isInterrupt(result) {
+			return result
+		}
+		results = append(results, result)
+	}
+	return &object.List{Elements: results}
+}
+
+// evalSortExpression sorts numbers by value and text alphabetically. Items
+// that compare equal keep their order.
+func evalSortExpression(se *ast.SortExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(se.List, env, "sorted")
+	if errObj != nil {
+		return errObj
+	}
+
+	keys := items
+	switch {
+	case se.Key != nil:
+		fn, errObj := evalFunctionValue(se.Key, env)
+		if errObj != nil {
+			return errObj
+		}
+		keys = make([]object.Object, len(items))
+		for i, item := range items {
+			keys[i] = applyFunction(fn, []object.Object{item})
+			if isInterrupt(keys[i]) {
+				return keys[i]
+			}
+		}
+	case se.Field != nil:
+		name := Eval(se.Field, env)
+		if isInterrupt(name) {
+			return name
+		}
+		nameStr, ok := name.(*object.String)
+		if !ok {
+			return newError("field name must be a string, got %s", name.Type())
+		}
+		keys = make([]object.Object, len(items))
+		for i, item := range items {
+			switch src := item.(type) {
+			case *object.Json:
+				keys[i] = getJsonField(src.Value, nameStr.Value)
+			case *object.Dictionary:
+				keys[i] = getDictionaryField(src, nameStr.Value)
+			default:
+				return newError("sorted by field requires dictionaries or json objects, got %s", item.Type())
+			}
+			if isInterrupt(keys[i]) {
+				return keys[i]
+			}
+		}
+	}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	var sortErr *object.Error
+	sort.SliceStable(order, func(a, b int) bool {
+		cmp, err := compareValues(keys[order[a]], keys[order[b]])
+		if err != nil && sortErr == nil {
+			sortErr = err
+		}
+		return cmp < 0
+	})
+	if sortErr != nil {
+		return sortErr
+	}
+
+	sorted := make([]object.Object, len(items))
+	for i, index := range order {
+		sorted[i] = items[index]
+	}
+	return &object.List{Elements: sorted}
+}
+
+func evalAggregateExpression(ae *ast.AggregateExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(ae.List, env, "the "+ae.Operator+" of")
+	if errObj != nil {
+		return errObj
+	}
+
+	switch ae.Operator {
+	case "sum", "average":
+		var total object.Object = &object.Integer{Value: 0}
+		for _, item := range items {
+			if !isNumber(item) {
+				return newError("the %s of requires numbers, got %s", ae.Operator, item.Type())
+			}
+			total = evalNumberArithmetic("plus", total, item)
+		}
+		if ae.Operator == "sum" {
+			return total
+		}
+		if len(items) == 0 {
+			return newKindError(mathErrorKind, "the average of an empty list")
+		}
+		sum, _ := toFloat(total)
+		return &object.Float{Value: sum / float64(len(items))}
+	}
+
+	// max and min
+	if len(items) == 0 {
+		return newKindError(mathErrorKind, "the %s of an empty list", ae.Operator)
+	}
+	best := items[0]
+	for _, item := range items[1:] {
+		cmp, err := compareValues(item, best)
+		if err != nil {
+			return err
+		}
+		if (ae.Operator == "max" && cmp > 0) || (ae.Operator == "min" && cmp < 0) {
+			best = item
+		}
+	}
+	return best
+}
+
+// evalReduceExpression combines the items in order by calling the
+// function with the total so far and the next item
+func evalReduceExpression(re *ast.ReduceExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(re.List, env, "total of")
+	if errObj != nil {
+		return errObj
+	}
+	fn, errObj := evalFunctionValue(re.Function, env)
+	if errObj != nil {
+		return errObj
+	}
+
+	var total object.Object
+	if re.Initial != nil {
+		total = Eval(re.Initial, env)
+		if isInterrupt(total) {
+			return total
+		}
+	} else {
+		if len(items) == 0 {
+			return newError("total of an empty list needs a starting value: total of ... using ... starting from ...")
+		}
+		total, items = items[0], items[1:]
+	}
+
+	for _, item := range items {
+		total = applyFunction(fn, []object.Object{total, item})
+		if isInterrupt(total) {
+			return total
+		}
+	}
+	return total
+}
+
+// evalReverseExpression reverses a list, or the characters of a string
+func evalReverseExpression(re *ast.ReverseExpression, env *object.Environment) object.Object {
+	val := Eval(re.List, env)
+	if isInterrupt(val) {
+		return val
+	}
+
+	if str, ok := val.(*object.String); ok {
+		chars := object.Graphemes(str.Value)
+		for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+			chars[i], chars[j] = chars[j], chars[i]
+		}
+		return &object.String{Value: strings.Join(chars, "")}
+	}
+
+	items, ok := listItems(val)
+	if !ok {
+		return newError("reverse of requires a list or string, got %s", val.Type())
+	}
+	reversed := make([]object.Object, len(items))
+	for i, item := range items {
+		reversed[len(items)-1-i] = item
+	}
+	return &object.List{Elements: reversed}
+}
+
+// evalUniqueExpression keeps the first of each group of equal items
+func evalUniqueExpression(ue *ast.UniqueExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(ue.List, env, "unique items in")
+	if errObj != nil {
+		return errObj
+	}
+
+	unique := []object.Object{}
+	for _, item := range items {
+		seen := false
+		for _, kept := range unique {
+			if valuesEqual(item, kept) {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			unique = append(unique, item)
+		}
+	}
+	return &object.List{Elements: unique}
+}
+
+// evalTakeExpression returns up to count items from the start or end
+func evalTakeExpression(te *ast.TakeExpression, env *object.Environment) object.Object {
+	count := Eval(te.Count, env)
+	if isInterrupt(count) {
+		return count
+	}
+	n, ok := count.(*object.Integer)
+	if !ok || n.Value < 0 {
+		return newError("%s requires a whole number of items, got %s", te.Token.Literal, count.Inspect())
+	}
+
+	items, errObj := evalListOperand(te.List, env, te.Token.Literal+" items of")
+	if errObj != nil {
+		return errObj
+	}
+
+	take := int(n.Value)
+	if take > len(items) {
+		take = len(items)
+	}
+	taken := make([]object.Object, take)
+	if te.FromEnd {
+		copy(taken, items[len(items)-take:])
+	} else {
+		copy(taken, items[:take])
+	}
+	return &object.List{Elements: taken}
+}
+
+// Text operations. Each returns new text, and counts and measures in
+// characters as people see them, using object.Graphemes.
+
+// evalText evaluates the text an operation works on
+func evalText(node ast.Expression, env *object.Environment, operation string) (string, object.Object) {
+	val := Eval(node, env)
+	if isInterrupt(val) {
+		return "", val
+	}
+
+	str, ok := val.(*object.String)
+	if !ok {
+		return "", newError("%s requires text, got %s", operation, val.Type())
+	}
+	return str.Value, nil
+}
+
+// evalSplitExpression splits text at each separator, or into characters
+// when the separator is empty
+func evalSplitExpression(se *ast.SplitExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(se.Text, env, "split")
+	if errObj != nil {
+		return errObj
+	}
+	separator, errObj := evalText(se.Separator, env, "split ... by")
+	if errObj != nil {
+		return errObj
+	}
+
+	if separator == "" {
+		return textList(object.Graphemes(text))
+	}
+	return textList(strings.Split(text, separator))
+}
+
+// evalJoinExpression joins a list's items into text, writing items that
+// are not text the way say would
+func evalJoinExpression(je *ast.JoinExpression, env *object.Environment) object.Object {
+	items, errObj := evalListOperand(je.List, env, "join")
+	if errObj != nil {
+		return errObj
+	}
+
+	separator := ""
+	if je.Separator != nil {
+		separator, errObj = evalText(je.Separator, env, "join ... with")
+		if errObj != nil {
+			return errObj
+		}
+	}
+
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = item.Inspect()
+	}
+	return &object.String{Value: strings.Join(parts, separator)}
+}
+
+func evalLetterCaseExpression(lc *ast.LetterCaseExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(lc.Text, env, lc.Token.Literal+" of")
+	if errObj != nil {
+		return errObj
+	}
+	if lc.Upper {
+		return &object.String{Value: strings.ToUpper(text)}
+	}
+	return &object.String{Value: strings.ToLower(text)}
+}
+
+// evalTrimExpression removes whitespace, including Unicode spaces, from
+// both ends of text
+func evalTrimExpression(te *ast.TrimExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(te.Text, env, "trim")
+	if errObj != nil {
+		return errObj
+	}
+	return &object.String{Value: strings.TrimSpace(text)}
+}
+
+// evalReplaceExpression replaces every occurrence of one piece of text
+func evalReplaceExpression(re *ast.ReplaceExpression, env *object.Environment) object.Object {
+	var pattern *regexp.Regexp
+	var old string
+	var errObj object.Object
+	if re.Pattern != nil {
+		pattern, errObj = evalPattern(re.Pattern, env)
+	} else {
+		old, errObj = evalText(re.Old, env, "replace")
+		if errObj == nil && old == "" {
+			errObj = newError("replace needs some text to look for, got empty text")
+		}
+	}
+	if errObj != nil {
+		return errObj
+	}
+
+	replacement, errObj := evalText(re.New, env, "replace ... with")
+	if errObj != nil {
+		return errObj
+	}
+	text, errObj := evalText(re.Text, env, "replace ... in")
+	if errObj != nil {
+		return errObj
+	}
+
+	if pattern != nil {
+		return &object.String{Value: pattern.ReplaceAllString(text, replacement)}
+	}
+	return &object.String{Value: strings.ReplaceAll(text, old, replacement)}
+}
+
+// compiledPattern is a pattern's text and its compiled form
+type compiledPattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+// patterns caches the compiled regular expression of each pattern in the
+// program, so a route handler does not compile its patterns again on every
+// request. Handlers run concurrently, hence the sync.Map. A pattern built
+// from a variable is compiled again only when its text changes.
+var patterns sync.Map // *ast.Pattern -> *compiledPattern
+
+// evalPattern returns the compiled regular expression for a pattern
+func evalPattern(pt *ast.Pattern, env *object.Environment) (*regexp.Regexp, object.Object) {
+	source, errObj := evalText(pt.Source, env, "pattern")
+	if errObj != nil {
+		return nil, errObj
+	}
+
+	if cached, ok := patterns.Load(pt); ok {
+		if c := cached.(*compiledPattern); c.source == source {
+			return c.re, nil
+		}
+	}
+
+	re, err := regexp.Compile(source)
+	if err != nil {
+		return nil, newError("invalid pattern %q: %s", source, strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+	}
+	patterns.Store(pt, &compiledPattern{source: source, re: re})
+	return re, nil
+}
+
+// evalMatchExpression reports whether the pattern matches anywhere in the
+// text; ^ and $ anchor it to the start and end
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(me.Text, env, "matches")
+	if errObj != nil {
+		return errObj
+	}
+	re, errObj := evalPattern(me.Pattern, env)
+	if errObj != nil {
+		return errObj
+	}
+	return nativeBoolToBooleanObject(re.MatchString(text) != me.Negated)
+}
+
+// evalFindExpression returns the first match, or null when there is none;
+// a list of every match; or the text caught by each group of the first or
+// every match. A group that took no part in a match catches empty text.
+func evalFindExpression(fe *ast.FindExpression, env *object.Environment) object.Object {
+	re, errObj := evalPattern(fe.Pattern, env)
+	if errObj != nil {
+		return errObj
+	}
+	text, errObj := evalText(fe.Text, env, "pattern ... in")
+	if errObj != nil {
+		return errObj
+	}
+
+	if fe.Captures && re.NumSubexp() == 0 {
+		return newError("captures need a pattern with groups in parentheses, got %q", re.String())
+	}
+
+	switch {
+	case fe.All && fe.Captures:
+		matches := re.FindAllStringSubmatch(text, -1)
+		elements := make([]object.Object, len(matches))
+		for i, groups := range matches {
+			elements[i] = textList(groups[1:])
+		}
+		return &object.List{Elements: elements}
+	case fe.All:
+		return textList(re.FindAllString(text, -1))
+	case fe.Captures:
+		groups := re.FindStringSubmatch(text)
+		if groups == nil {
+			return textList(nil)
+		}
+		return textList(groups[1:])
+	}
+
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return NULL
+	}
+	return &object.String{Value: text[loc[0]:loc[1]]}
+}
+
+// textList returns a list holding each string as text
+func textList(values []string) *object.List {
+	elements := make([]object.Object, len(values))
+	for i, value := range values {
+		elements[i] = &object.String{Value: value}
+	}
+	return &object.List{Elements: elements}
+}
+
+// evalPositionExpression returns the 1-based position of the first
+// occurrence of text in text, or of an item in a list, and 0 when there is
+// none
+func evalPositionExpression(pe *ast.PositionExpression, env *object.Environment) object.Object {
+	target := Eval(pe.Target, env)
+	if isInterrupt(target) {
+		return target
+	}
+	source := Eval(pe.Source, env)
+	if isInterrupt(source) {
+		return source
+	}
+
+	if str, ok := source.(*object.String); ok {
+		needle, ok := target.(*object.String)
+		if !ok {
+			return newError("position of ... in text requires text to look for, got %s", target.Type())
+		}
+		at := strings.Index(str.Value, needle.Value)
+		if at < 0 {
+			return &object.Integer{Value: 0}
+		}
+		return &object.Integer{Value: int64(len(object.Graphemes(str.Value[:at])) + 1)}
+	}
+
+	items, ok := listItems(source)
+	if !ok {
+		return newError("position of requires a list or text, got %s", source.Type())
+	}
+	for i, item := range items {
+		if valuesEqual(item, target) {
+			return &object.Integer{Value: int64(i + 1)}
+		}
+	}
+	return &object.Integer{Value: 0}
+}
+
+// evalCharactersExpression returns the characters between two positions,
+// inclusive, counting negative positions back from the end
+func evalCharactersExpression(ce *ast.CharactersExpression, env *object.Environment) object.Object {
+	from := Eval(ce.From, env)
+	if isInterrupt(from) {
+		return from
+	}
+	to := Eval(ce.To, env)
+	if isInterrupt(to) {
+		return to
+	}
+
+	start, errObj := zeroBased(from)
+	if errObj != nil {
+		return errObj
+	}
+	end, errObj := zeroBased(to)
+	if errObj != nil {
+		return errObj
+	}
+
+	text, errObj := evalText(ce.Text, env, "characters ... of")
+	if errObj != nil {
+		return errObj
+	}
+
+	chars := object.Graphemes(text)
+	start, end, ok := sliceRange(start, end, len(chars))
+	if !ok {
+		return newError("characters %s to %s out of bounds (text has %d characters)", from.Inspect(), to.Inspect(), len(chars))
+	}
+	return &object.String{Value: strings.Join(chars[start:end], "")}
+}
+
+func evalRepeatedExpression(re *ast.RepeatedExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(re.Text, env, "repeated")
+	if errObj != nil {
+		return errObj
+	}
+
+	count := Eval(re.Count, env)
+	if isInterrupt(count) {
+		return count
+	}
+	n, ok := count.(*object.Integer)
+	if !ok || n.Value < 0 {
+		return newError("repeated requires a whole number of times, got %s", count.Inspect())
+	}
+	return &object.String{Value: strings.Repeat(text, int(n.Value))}
+}
+
+// evalPadExpression adds a fill character to text until it is at least
+// the given number of characters long
+func evalPadExpression(pe *ast.PadExpression, env *object.Environment) object.Object {
+	text, errObj := evalText(pe.Text, env, "pad")
+	if errObj != nil {
+		return errObj
+	}
+
+	width := Eval(pe.Width, env)
+	if isInterrupt(width) {
+		return width
+	}
+	n, ok := width.(*object.Integer)
+	if !ok || n.Value < 0 {
+		return newError("pad requires a whole number of characters, got %s", width.Inspect())
+	}
+
+	fill := " "
+	if pe.Fill != nil {
+		fill, errObj = evalText(pe.Fill, env, "pad ... with")
+		if errObj != nil {
+			return errObj
+		}
+		if len(object.Graphemes(fill)) != 1 {
+			return newError("pad needs a single character to fill with, got %q", fill)
+		}
+	}
+
+	missing := int(n.Value) - len(object.Graphemes(text))
+	if missing <= 0 {
+		return &object.String{Value: text}
+	}
+	padding := strings.Repeat(fill, missing)
+	if pe.Left {
+		return &object.String{Value: padding + text}
+	}
+	return &object.String{Value: text + padding}
+}
+
+// Conversions and type checks
+
+// typeName returns the name scripts use for the type of a value
+func typeName(obj object.Object) string {
+	switch v := obj.(type) {
+	case *object.Integer, *object.Float:
+		return "number"
+	case *object.String:
+		return "text"
+	case *object.Boolean:
+		return "boolean"
+	case *object.List:
+		return "list"
+	case *object.Dictionary:
+		return "dictionary"
+	case *object.Json:
+		if _, ok := v.Value.([]interface{}); ok {
+			return "list"
+		}
+		return "dictionary"
+	case *object.Function:
+		return "function"
+	case *object.Module:
+		return "module"
+	case *object.Null:
+		return "nothing"
+	}
+	return strings.ToLower(string(obj.Type()))
+}
+
+func evalTypeOfExpression(to *ast.TypeOfExpression, env *object.Environment) object.Object {
+	val := Eval(to.Value, env)
+	if isInterrupt(val) {
+		return val
+	}
+	return &object.String{Value: typeName(val)}
+}
+
+func evalTypeCheckExpression(tc *ast.TypeCheckExpression, env *object.Environment) object.Object {
+	val := Eval(tc.Value, env)
+	if isInterrupt(val) {
+		return val
+	}
+	return nativeBoolToBooleanObject((typeName(val) == tc.TypeName) != tc.Negated)
+}
+
+// numberText is the form of text that converts to a number
+var numberText = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+func evalConversionExpression(ce *ast.ConversionExpression, env *object.Environment) object.Object {
+	val := Eval(ce.Value, env)
+	if isInterrupt(val) {
+		return val
+	}
+
+	switch ce.Target {
+	case "number":
+		return toNumber(val)
+	case "text":
+		if _, ok := val.(*object.String); ok {
+			return val
+		}
+		return &object.String{Value: val.Inspect()}
+	case "boolean":
+		return toBoolean(val)
+	}
+	return toList(val)
+}
+
+// conversionError reports a value that cannot be read as the given type
+func conversionError(val object.Object, target string) *object.Error {
+	return newKindError(conversionErrorKind, "could not read '%s' as %s", val.Inspect(), target)
+}
+
+// toNumber reads a number from text such as "42", " 3.5 " or "-1e3".
+// Text written as a whole number becomes an integer; anything with a
+// decimal point or an exponent becomes a decimal, even "1e3".
+func toNumber(val object.Object) object.Object {
+	switch v := val.(type) {
+	case *object.Integer, *object.Float:
+		return val
+	case *object.String:
+		text := strings.TrimSpace(v.Value)
+		if !numberText.MatchString(text) {
+			return conversionError(val, "a number")
+		}
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return &object.Integer{Value: i}
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return conversionError(val, "a number")
+		}
+		return &object.Float{Value: f}
+	}
+	return conversionError(val, "a number")
+}
+
+// toBoolean reads true from "true", "yes" or 1 and false from "false",
+// "no" or 0, ignoring case and surrounding spaces
+func toBoolean(val object.Object) object.Object {
+	switch v := val.(type) {
+	case *object.Boolean:
+		return val
+	case *object.Integer:
+		switch v.Value {
+		case 1:
+			return TRUE
+		case 0:
+			return FALSE
+		}
+	case *object.String:
+		switch strings.ToLower(strings.TrimSpace(v.Value)) {
+		case "true", "yes", "1":
+			return TRUE
+		case "false", "no", "0":
+			return FALSE
+		}
+	}
+	return conversionError(val, "a boolean")
+}
+
+// toList returns a new list of a list's or JSON array's items, or of the
+// characters of text
+func toList(val object.Object) object.Object {
+	if str, ok := val.(*object.String); ok {
+		return textList(object.Graphemes(str.Value))
+	}
+	items, ok := listItems(val)
+	if !ok {
+		return conversionError(val, "a list")
+	}
+	elements := make([]object.Object, len(items))
+	copy(elements, items)
+	return &object.List{Elements: elements}
+}
+
+// Modules
+
+var (
+	// modules holds every module that has started loading, by absolute
+	// path, so each file is evaluated only once however many files use it.
+	// Scripts can run at the same time, so it is only used under modulesMu.
+	modules   = map[string]*moduleEntry{}
+	modulesMu sync.Mutex
+)
+
+// moduleEntry is a module in the registry. While the file is running its
+// module is nil and done is open.
+type moduleEntry struct {
+	module *object.Module
+	usedBy string // the file that started loading it
+	done   chan struct{}
+}
+
+// standardDir stands in for the directory of the standard modules, which
+// are built into the interpreter instead of read from disk
+const standardDir = "<standard>"
+
+// ReadSource returns the source of a script or module file, including the
+// standard modules
+func ReadSource(file string) (string, error) {
+	if name, ok := strings.CutPrefix(file, standardDir+"/"); ok {
+		source, ok := stdlib.Source(strings.TrimSuffix(name, ".abc"))
+		if !ok {
+			return "", fs.ErrNotExist
+		}
+		return source, nil
+	}
+	content, err := os.ReadFile(file)
+	return string(content), err
+}
+
+// moduleKey identifies the module at path in the registry
+func moduleKey(path string) (string, error) {
+	if strings.HasPrefix(path, standardDir+"/") {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// evalUseStatement loads a module and either binds it to a name or, without
+// one, makes each of its exports readable in the file that uses it
+func evalUseStatement(us *ast.UseStatement, env *object.Environment) object.Object {
+	importer := env.File()
+	path := us.Path
+	switch {
+	case us.Standard:
+		if _, ok := stdlib.Source(us.Path); !ok {
+			return newError("there is no standard module called %s", us.Path)
+		}
+		path = standardDir + "/" + us.Path + ".abc"
+	case !filepath.IsAbs(path):
+		path = filepath.Join(filepath.Dir(importer), path)
+	}
+
+	mod, errObj := loadModule(path, importer)
+	if errObj != nil {
+		// An error from inside the module records where it was used
+		if err, ok := errObj.(*object.Error); ok && err.File != "" {
+			err.Stack = append(err.Stack, object.StackFrame{Function: "use " + us.Path, Line: us.Token.Line})
+		}
+		return errObj
+	}
+
+	if us.Name != nil {
+		assign(env, us.Name, mod)
+		return NULL
+	}
+	// Exports are read through the module, so the file always sees their
+	// current values
+	env.Import(mod)
+	return NULL
+}
+
+// loadModule returns the module at path, running it the first time any
+// file uses it
+func loadModule(path, importer string) (*object.Module, object.Object) {
+	key, err := moduleKey(path)
+	if err != nil {
+		return nil, newError("could not use %s: %s", path, err)
+	}
+	importerKey := ""
+	if importer != "" {
+		importerKey, _ = moduleKey(importer)
+	}
+
+	entry, errObj := claimModule(key, importerKey)
+	if entry == nil {
+		return nil, errObj
+	}
+	if entry.module != nil {
+		return entry.module, nil
+	}
+
+	mod, errObj := runModule(path)
+	modulesMu.Lock()
+	if mod != nil {
+		entry.module = mod
+	} else {
+		// Forget the failed load so a later use tries again
+		delete(modules, key)
+	}
+	modulesMu.Unlock()
+	close(entry.done)
+	return mod, errObj
+}
+
+// claimModule finds the module at key in the registry. If it has not been
+// loaded it registers it as loading, and the caller must then run it. If
+// another script is loading it, claimModule waits for that to finish.
+func claimModule(key, importerKey string) (*moduleEntry, object.Object) {
+	modulesMu.Lock()
+	for {
+		entry, ok := modules[key]
+		if ok && entry.module != nil {
+			modulesMu.Unlock()
+			return entry, nil
+		}
+
+		// Follow the files using each other back from the importer; if
+		// that reaches this module, they use each other in a circle
+		chain := []string{filepath.Base(key)}
+		for file := importerKey; file != ""; {
+			chain = append([]string{filepath.Base(file)}, chain...)
+			if file == key {
+				modulesMu.Unlock()
+				return nil, newError("circular use: %s", strings.Join(chain, " → "))
+			}
+			loading, ok := modules[file]
+			if !ok {
+				break
+			}
+			file = loading.usedBy
+		}
+
+		if !ok {
+			entry = &moduleEntry{usedBy: importerKey, done: make(chan struct{})}
+			modules[key] = entry
+			modulesMu.Unlock()
+			return entry, nil
+		}
+		modulesMu.Unlock()
+		<-entry.done
+		modulesMu.Lock()
+	}
+}
+
+// runModule evaluates the file at path in an environment of its own and
+// collects the names it exports
+func runModule(path string) (*object.Module, object.Object) {
+	source, err := ReadSource(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newError("could not use %s: no such file", path)
+		}
+		return nil, newError("could not use %s: %s", path, err)
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, newError("could not use %s: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	moduleEnv := object.NewFileEnvironment(path)
+	if result := Eval(program, moduleEnv); isInterrupt(result) {
+		if err, ok := result.(*object.Error); ok && err.File == "" {
+			err.File = path
+		}
+		return nil, result
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	mod := &object.Module{Name: name, Path: path, Env: moduleEnv}
+	for _, stmt := range program.Statements {
+		export, ok := stmt.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		for _, exported := range export.Names {
+			if _, ok := moduleEnv.Get(exported.Value); !ok {
+				err := newKindError(nameErrorKind, "%s exports %s but never defines it", name, exported.Value)
+				err.File = path
+				err.Line, err.Column = exported.Token.Line, exported.Token.Column
+				return nil, err
+			}
+			mod.Exports = append(mod.Exports, exported.Value)
+		}
+	}
+	return mod, nil
+}
+
+// evalMemberExpression looks up an export of a module, reading its current
+// value so modules can keep state
+func evalMemberExpression(me *ast.MemberExpression, env *object.Environment) object.Object {
+	val := Eval(me.Module, env)
+	if isInterrupt(val) {
+		return val
+	}
+
+	mod, ok := val.(*object.Module)
+	if !ok {
+		return newError("%s is not a module, it is %s", me.Module.String(), typeName(val))
+	}
+
+	member, ok := mod.Exported(me.Name.Value)
+	if !ok {
+		return newKindError(nameErrorKind, "%s has no export called %s", mod.Name, me.Name.Value)
+	}
+	return member
+}
+
+func evalDictionaryLiteral(dl *ast.DictionaryLiteral, env *object.Environment) object.Object {
+	dict := object.NewDictionary()
+	for _, pair := range dl.Pairs {
+		key := Eval(pair.Key, env)
+		if isInterrupt(key) {
+			return key
+		}
+
+		keyStr, ok := key.(*object.String)
+		if !ok {
+			return newError("dictionary keys must be strings, got %s", key.Type())
+		}
+
+		value := Eval(pair.Value, env)
+		if isInterrupt(value) {
+			return value
+		}
+
+		dict.Set(keyStr.Value, value)
 	}
-	env.Set(fd.Name.Value, fn)
-	return fn
+	return dict
 }
 
-func evalCallExpression(ce *ast.CallExpression, env *object.Environment) object.Object {
-	fnObj, ok := env.Get(ce.Function.Value)
-	if !ok {
-		return newError("function not defined: %s", ce.Function.Value)
+func evalSetKeyStatement(sk *ast.SetKeyStatement, env *object.Environment) object.Object {
+	key := Eval(sk.Key, env)
+	if isInterrupt(key) {
+		return key
 	}
 
-	fn, ok := fnObj.(*object.Function)
+	keyStr, ok := key.(*object.String)
 	if !ok {
-		return newError("%s is not a function", ce.Function.Value)
+		return newError("dictionary keys must be strings, got %s", key.Type())
 	}
 
-	// Evaluate arguments
-	args := []object.Object{}
-	for _, arg := range ce.Arguments {
-		evaluated := Eval(arg, env)
-		if isError(evaluated) {
-			return evaluated
-		}
-		args = append(args, evaluated)
+	targetObj, ok := env.Get(sk.Target.Value)
+	if !ok {
+		return newKindError(nameErrorKind, "undefined variable: %s", sk.Target.Value)
 	}
 
-	// Create new environment for function
-	extendedEnv := object.NewEnclosedEnvironment(fn.Env)
-
-	// Bind parameters
-	for i, param := range fn.Parameters {
-		if i < len(args) {
-			extendedEnv.Set(param.Value, args[i])
-		}
+	dict, ok := targetObj.(*object.Dictionary)
+	if !ok {
+		return newError("set ... of requires a dictionary, got %s", targetObj.Type())
 	}
 
-	// Execute function body
-	result := Eval(fn.Body, extendedEnv)
-
-	// Unwrap return value
-	if returnValue, ok := result.(*object.ReturnValue); ok {
-		return returnValue.Value
+	value := Eval(sk.Value, env)
+	if isInterrupt(value) {
+		return value
 	}
 
-	return result
+	dict.Set(keyStr.Value, value)
+	return value
 }
 
-func evalReturnStatement(rs *ast.ReturnStatement, env *object.Environment) object.Object {
-	if rs.ReturnValue == nil {
-		return &object.ReturnValue{Value: NULL}
+// evalRemoveStatement removes a key from a dictionary, or from a list the
+// item at a position or the first item equal to a value. Removing a key or
+// value that is not there does nothing.
+func evalRemoveStatement(rs *ast.RemoveStatement, env *object.Environment) object.Object {
+	if rs.Position != nil {
+		return evalRemoveItem(rs, env)
 	}
 
-	val := Eval(rs.ReturnValue, env)
-	if isError(val) {
-		return val
+	key := Eval(rs.Key, env)
+	if isInterrupt(key) {
+		return key
 	}
-	return &object.ReturnValue{Value: val}
-}
 
-func evalSayStatement(ss *ast.SayStatement, env *object.Environment) object.Object {
-	val := Eval(ss.Value, env)
-	if isError(val) {
-		return val
+	targetObj, ok := env.Get(rs.Target.Value)
+	if !ok {
+		return newKindError(nameErrorKind, "undefined variable: %s", rs.Target.Value)
 	}
-	fmt.Println(val.Inspect())
-	return NULL
-}
 
-func evalAskStatement(as *ast.AskStatement, env *object.Environment) object.Object {
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
-	if err != nil {
-		return newError("error reading input: %s", err)
+	if list, ok := targetObj.(*object.List); ok {
+		list.RemoveFirst(func(item object.Object) bool {
+			return valuesEqual(item, key)
+		})
+		return NULL
 	}
 
-	// Remove newline
-	if len(input) > 0 && input[len(input)-1] == '\n' {
-		input = input[:len(input)-1]
+	dict, ok := targetObj.(*object.Dictionary)
+	if !ok {
+		return newError("remove requires a list or dictionary, got %s", targetObj.Type())
 	}
-	if len(input) > 0 && input[len(input)-1] == '\r' {
-		input = input[:len(input)-1]
+
+	keyStr, ok := key.(*object.String)
+	if !ok {
+		return newError("dictionary keys must be strings, got %s", key.Type())
 	}
 
-	result := &object.String{Value: input}
-	env.Set(as.Target.Value, result)
-	return result
+	dict.Delete(keyStr.Value)
+	return NULL
 }
 
-func evalLengthExpression(le *ast.LengthExpression, env *object.Environment) object.Object {
-	val := Eval(le.List, env)
-	if isError(val) {
-		return val
+func evalRemoveItem(rs *ast.RemoveStatement, env *object.Environment) object.Object {
+	position := Eval(rs.Position, env)
+	if isInterrupt(position) {
+		return position
 	}
-
-	switch v := val.(type) {
-	case *object.List:
-		return &object.Integer{Value: int64(len(v.Elements))}
-	case *object.String:
-		return &object.Integer{Value: int64(len(v.Value))}
-	default:
-		return newError("length requires a list or string, got %s", val.Type())
+	i, errObj := zeroBased(position)
+	if errObj != nil {
+		return errObj
 	}
-}
 
-func evalIndexExpression(ie *ast.IndexExpression, env *object.Environment) object.Object {
-	index := Eval(ie.Index, env)
-	if isError(index) {
-		return index
+	list, errObj := targetList(rs.Target, env, "remove item")
+	if errObj != nil {
+		return errObj
 	}
 
-	list := Eval(ie.List, env)
-	if isError(list) {
-		return list
+	if _, ok := list.RemoveAt(i); !ok {
+		return newError("index out of bounds: %s (list has %d elements)", position.Inspect(), list.Len())
 	}
+	return NULL
+}
 
-	idx, ok := index.(*object.Integer)
-	if !ok {
-		return newError("index must be an integer, got %s", index.Type())
+func evalKeysOfExpression(ko *ast.KeysOfExpression, env *object.Environment) object.Object {
+	source := Eval(ko.Source, env)
+	if isInterrupt(source) {
+		return source
 	}
 
-	switch l := list.(type) {
-	case *object.List:
-		if idx.Value < 1 || idx.Value > int64(len(l.Elements)) {
-			return newError("index out of bounds: %d (list has %d elements)", idx.Value, len(l.Elements))
+	keys := []object.Object{}
+	switch src := source.(type) {
+	case *object.Dictionary:
+		names, _ := src.Entries()
+		for _, key := range names {
+			keys = append(keys, &object.String{Value: key})
 		}
-		return l.Elements[idx.Value-1] // 1-indexed
-	case *object.String:
-		if idx.Value < 1 || idx.Value > int64(len(l.Value)) {
-			return newError("index out of bounds: %d (string has %d characters)", idx.Value, len(l.Value))
+	case *object.Json:
+		obj, ok := src.Value.(map[string]interface{})
+		if !ok {
+			return newError("keys of requires a json object, got a json array or value")
+		}
+		names := make([]string, 0, len(obj))
+		for key := range obj {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		for _, key := range names {
+			keys = append(keys, &object.String{Value: key})
 		}
-		return &object.String{Value: string(l.Value[idx.Value-1])} // 1-indexed
 	default:
-		return newError("indexing requires a list or string, got %s", list.Type())
+		return newError("keys of requires a dictionary, got %s", source.Type())
 	}
-}
 
-func evalAppendStatement(as *ast.AppendStatement, env *object.Environment) object.Object {
-	value := Eval(as.Value, env)
-	if isError(value) {
-		return value
-	}
+	return &object.List{Elements: keys}
+}
 
-	listObj, ok := env.Get(as.List.Value)
-	if !ok {
-		return newError("undefined variable: %s", as.List.Value)
+func evalValuesOfExpression(vo *ast.ValuesOfExpression, env *object.Environment) object.Object {
+	source := Eval(vo.Source, env)
+	if isInterrupt(source) {
+		return source
 	}
 
-	list, ok := listObj.(*object.List)
+	dict, ok := source.(*object.Dictionary)
 	if !ok {
-		return newError("append requires a list, got %s", listObj.Type())
+		return newError("values of requires a dictionary, got %s", source.Type())
 	}
 
-	list.Elements = append(list.Elements, value)
-	return NULL
+	_, values := dict.Entries()
+	return &object.List{Elements: values}
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
@@ -568,30 +2463,32 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 
 	val, ok := env.Get(node.Value)
 	if !ok {
-		return newError("undefined variable: %s", node.Value)
+		return newKindError(nameErrorKind, "undefined variable: %s", node.Value)
 	}
 	return val
 }
 
 func evalNegativeExpression(ne *ast.NegativeExpression, env *object.Environment) object.Object {
 	val := Eval(ne.Value, env)
-	if isError(val) {
+	if isInterrupt(val) {
 		return val
 	}
 
-	intVal, ok := val.(*object.Integer)
-	if !ok {
-		return newError("minus requires an integer, got %s", val.Type())
+	switch v := val.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -v.Value}
+	case *object.Float:
+		return &object.Float{Value: -v.Value}
+	default:
+		return newError("minus requires a number, got %s", val.Type())
 	}
-
-	return &object.Integer{Value: -intVal.Value}
 }
 
 func evalListLiteral(ll *ast.ListLiteral, env *object.Environment) object.Object {
 	elements := []object.Object{}
 	for _, elem := range ll.Elements {
 		evaluated := Eval(elem, env)
-		if isError(evaluated) {
+		if isInterrupt(evaluated) {
 			return evaluated
 		}
 		elements = append(elements, evaluated)
@@ -601,79 +2498,259 @@ func evalListLiteral(ll *ast.ListLiteral, env *object.Environment) object.Object
 
 func evalComparisonExpression(ce *ast.ComparisonExpression, env *object.Environment) object.Object {
 	left := Eval(ce.Left, env)
-	if isError(left) {
+	if isInterrupt(left) {
 		return left
 	}
 
-	right := Eval(ce.Right, env)
-	if isError(right) {
-		return right
+	var right object.Object = NULL
+	if ce.Right != nil {
+		right = Eval(ce.Right, env)
+		if isInterrupt(right) {
+			return right
+		}
 	}
 
+	var result bool
+	var errObj *object.Error
+
 	switch ce.Operator {
 	case "equals":
-		return evalEquals(left, right)
-	case "greater":
-		return evalGreater(left, right)
-	case "less":
-		return evalLess(left, right)
+		result = valuesEqual(left, right)
+	case "greater", "less", "at least", "at most":
+		var order int
+		order, errObj = compareValues(left, right)
+		switch ce.Operator {
+		case "greater":
+			result = order > 0
+		case "less":
+			result = order < 0
+		case "at least":
+			result = order >= 0
+		case "at most":
+			result = order <= 0
+		}
+	case "between":
+		upper := Eval(ce.Upper, env)
+		if isInterrupt(upper) {
+			return upper
+		}
+		result, errObj = isBetween(left, right, upper)
+	case "contains":
+		result, errObj = containsValue(left, right)
+	case "in":
+		result, errObj = containsValue(right, left)
+	case "starts with", "ends with":
+		result, errObj = evalAffix(ce.Operator, left, right)
+	case "empty":
+		result, errObj = isEmpty(left)
+	default:
+		return newError("unknown comparison: %s", ce.Operator)
 	}
 
-	return FALSE
+	if errObj != nil {
+		return errObj
+	}
+	if ce.Negated {
+		result = !result
+	}
+	return nativeBoolToBooleanObject(result)
 }
 
 func evalEquals(left, right object.Object) object.Object {
-	// Handle null comparison
-	if left.Type() == object.NULL_OBJ && right.Type() == object.NULL_OBJ {
-		return TRUE
-	}
+	return nativeBoolToBooleanObject(valuesEqual(left, right))
+}
+
+// valuesEqual compares by content: numbers by value (2 equals 2.0), lists
+// and json arrays item by item, dictionaries and json objects key by key
+func valuesEqual(left, right object.Object) bool {
 	if left.Type() == object.NULL_OBJ || right.Type() == object.NULL_OBJ {
-		return FALSE
+		return left.Type() == right.Type()
+	}
+
+	if isNumber(left) && isNumber(right) {
+		return compareNumbers(left, right) == 0
 	}
 
 	switch l := left.(type) {
-	case *object.Integer:
-		if r, ok := right.(*object.Integer); ok {
-			return nativeBoolToBooleanObject(l.Value == r.Value)
-		}
 	case *object.String:
-		if r, ok := right.(*object.String); ok {
-			return nativeBoolToBooleanObject(l.Value == r.Value)
-		}
+		r, ok := right.(*object.String)
+		return ok && l.Value == r.Value
 	case *object.Boolean:
-		if r, ok := right.(*object.Boolean); ok {
-			return nativeBoolToBooleanObject(l.Value == r.Value)
+		r, ok := right.(*object.Boolean)
+		return ok && l.Value == r.Value
+	}
+
+	leftItems, leftOk := iterate(left)
+	rightItems, rightOk := iterate(right)
+	if !leftOk || !rightOk {
+		return left == right
+	}
+	if leftItems.byKey != rightItems.byKey || len(leftItems.values) != len(rightItems.values) {
+		return false
+	}
+
+	if !leftItems.byKey {
+		for i := range leftItems.values {
+			if !valuesEqual(leftItems.values[i], rightItems.values[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Keyed collections are equal whatever order their keys are in
+	rightByKey := make(map[string]object.Object, len(rightItems.keys))
+	for i, key := range rightItems.keys {
+		rightByKey[key.Inspect()] = rightItems.values[i]
+	}
+	for i, key := range leftItems.keys {
+		value, ok := rightByKey[key.Inspect()]
+		if !ok || !valuesEqual(leftItems.values[i], value) {
+			return false
 		}
 	}
-	return FALSE
+	return true
 }
 
-func evalGreater(left, right object.Object) object.Object {
-	leftInt, ok := left.(*object.Integer)
-	if !ok {
-		return newError("comparison requires integers, got %s", left.Type())
+// compareValues orders two numbers by value or two strings alphabetically,
+// returning -1, 0 or 1
+func compareValues(left, right object.Object) (int, *object.Error) {
+	if isNumber(left) && isNumber(right) {
+		return compareNumbers(left, right), nil
+	}
+
+	leftStr, leftIsString := left.(*object.String)
+	rightStr, rightIsString := right.(*object.String)
+	if leftIsString && rightIsString {
+		return strings.Compare(leftStr.Value, rightStr.Value), nil
+	}
+
+	return 0, newError("comparison requires two numbers or two strings, got %s and %s", left.Type(), right.Type())
+}
+
+func isBetween(value, lower, upper object.Object) (bool, *object.Error) {
+	fromLower, errObj := compareValues(value, lower)
+	if errObj != nil {
+		return false, errObj
+	}
+	toUpper, errObj := compareValues(value, upper)
+	if errObj != nil {
+		return false, errObj
+	}
+	return fromLower >= 0 && toUpper <= 0, nil
+}
+
+// containsValue reports whether text contains a piece of text, a list or
+// json array contains an item, or a dictionary or json object has a key
+func containsValue(container, item object.Object) (bool, *object.Error) {
+	if str, ok := container.(*object.String); ok {
+		part, ok := item.(*object.String)
+		if !ok {
+			return false, newError("contains on a string requires a string, got %s", item.Type())
+		}
+		return strings.Contains(str.Value, part.Value), nil
 	}
 
-	rightInt, ok := right.(*object.Integer)
+	items, ok := iterate(container)
 	if !ok {
-		return newError("comparison requires integers, got %s", right.Type())
+		return false, newError("contains requires a list, string, dictionary or json, got %s", container.Type())
 	}
 
-	return nativeBoolToBooleanObject(leftInt.Value > rightInt.Value)
+	candidates := items.values
+	if items.byKey {
+		candidates = items.keys
+	}
+	for _, candidate := range candidates {
+		if valuesEqual(candidate, item) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-func evalLess(left, right object.Object) object.Object {
-	leftInt, ok := left.(*object.Integer)
+// evalAffix handles "starts with" and "ends with" on strings
+func evalAffix(operator string, left, right object.Object) (bool, *object.Error) {
+	str, ok := left.(*object.String)
+	if !ok {
+		return false, newError("%s requires a string, got %s", operator, left.Type())
+	}
+	affix, ok := right.(*object.String)
 	if !ok {
-		return newError("comparison requires integers, got %s", left.Type())
+		return false, newError("%s requires a string, got %s", operator, right.Type())
+	}
+
+	if operator == "starts with" {
+		return strings.HasPrefix(str.Value, affix.Value), nil
+	}
+	return strings.HasSuffix(str.Value, affix.Value), nil
+}
+
+// isEmpty reports whether a value has nothing in it. Null counts as empty,
+// so a missing field or query parameter is empty too.
+func isEmpty(value object.Object) (bool, *object.Error) {
+	if value.Type() == object.NULL_OBJ {
+		return true, nil
+	}
+	if str, ok := value.(*object.String); ok {
+		return str.Value == "", nil
 	}
 
-	rightInt, ok := right.(*object.Integer)
+	items, ok := iterate(value)
 	if !ok {
-		return newError("comparison requires integers, got %s", right.Type())
+		return false, newError("is empty requires a list, string, dictionary or json, got %s", value.Type())
+	}
+	return len(items.values) == 0, nil
+}
+
+// compareNumbers returns -1, 0 or 1. Two integers are compared exactly;
+// otherwise both sides are compared as decimals.
+func compareNumbers(left, right object.Object) int {
+	leftInt, leftIsInt := left.(*object.Integer)
+	rightInt, rightIsInt := right.(*object.Integer)
+	if leftIsInt && rightIsInt {
+		switch {
+		case leftInt.Value < rightInt.Value:
+			return -1
+		case leftInt.Value > rightInt.Value:
+			return 1
+		}
+		return 0
+	}
+
+	leftVal, _ := toFloat(left)
+	rightVal, _ := toFloat(right)
+	switch {
+	case leftVal < rightVal:
+		return -1
+	case leftVal > rightVal:
+		return 1
+	}
+	return 0
+}
+
+// closeTo reports whether two numbers differ only by floating point rounding
+func closeTo(a, b object.Object) bool {
+	x, _ := toFloat(a)
+	y, _ := toFloat(b)
+	return math.Abs(x-y) <= 1e-9*math.Max(1, math.Abs(y))
+}
+
+func isNumber(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Float:
+		return true
 	}
+	return false
+}
 
-	return nativeBoolToBooleanObject(leftInt.Value < rightInt.Value)
+func toFloat(obj object.Object) (float64, bool) {
+	switch o := obj.(type) {
+	case *object.Integer:
+		return float64(o.Value), true
+	case *object.Float:
+		return o.Value, true
+	}
+	return 0, false
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -691,27 +2768,86 @@ func isTruthy(obj object.Object) bool {
 		return obj.Value
 	case *object.Integer:
 		return obj.Value != 0
+	case *object.Float:
+		return obj.Value != 0
 	default:
 		return true
 	}
 }
 
-func isError(obj object.Object) bool {
+// Error kinds, exposed to scripts as the "kind" of a caught problem
+const (
+	runtimeErrorKind    = "runtime"
+	nameErrorKind       = "name"
+	mathErrorKind       = "math"
+	httpErrorKind       = "http"
+	jsonErrorKind       = "json"
+	conversionErrorKind = "conversion"
+	raisedErrorKind     = "raised"
+)
+
+// isInterrupt reports whether obj must stop the statements around it: an
+// error, or a reply, which ends the request handler that produced it
+func isInterrupt(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.REPLY_VALUE_OBJ
 	}
 	return false
 }
 
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return newKindError(runtimeErrorKind, format, a...)
+}
+
+func newKindError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: kind}
+}
+
+// evalTryStatement runs the body and, if it fails, hands the error to the
+// handler instead of letting it abort the program
+func evalTryStatement(ts *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(ts.Body, env)
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result
+	}
+
+	if ts.Handler == nil {
+		return NULL
+	}
+	if ts.ErrorVar != nil {
+		assign(env, ts.ErrorVar, errorToDictionary(errObj))
+	}
+	return Eval(ts.Handler, env)
+}
+
+// errorToDictionary exposes a caught error to the script
+func errorToDictionary(errObj *object.Error) *object.Dictionary {
+	problem := object.NewDictionary()
+	problem.Set("message", &object.String{Value: errObj.Message})
+	problem.Set("kind", &object.String{Value: errObj.Kind})
+	problem.Set("line", &object.Integer{Value: int64(errObj.Line)})
+	return problem
+}
+
+func evalRaiseStatement(rs *ast.RaiseStatement, env *object.Environment) object.Object {
+	msg := Eval(rs.Message, env)
+	if isInterrupt(msg) {
+		return msg
+	}
+
+	if str, ok := msg.(*object.String); ok {
+		return newKindError(raisedErrorKind, "%s", str.Value)
+	}
+	return newKindError(raisedErrorKind, "%s", msg.Inspect())
 }
 
 // HTTP Interpreter Functions
 
 func evalFetchStatement(node *ast.FetchStatement, env *object.Environment) object.Object {
 	url := Eval(node.URL, env)
-	if isError(url) {
+	if isInterrupt(url) {
 		return url
 	}
 
@@ -723,7 +2859,7 @@ func evalFetchStatement(node *ast.FetchStatement, env *object.Environment) objec
 	var headers *object.List
 	if node.Headers != nil {
 		headersObj := Eval(node.Headers, env)
-		if isError(headersObj) {
+		if isInterrupt(headersObj) {
 			return headersObj
 		}
 		headers, ok = headersObj.(*object.List)
@@ -734,16 +2870,16 @@ func evalFetchStatement(node *ast.FetchStatement, env *object.Environment) objec
 
 	response, err := executeRequest("GET", urlStr.Value, "", headers)
 	if err != nil {
-		return newError("fetch failed: %s", err.Error())
+		return newKindError(httpErrorKind, "fetch failed: %s", err.Error())
 	}
 
-	env.Set(node.Target.Value, response)
+	assign(env, node.Target, response)
 	return response
 }
 
 func evalSendStatement(node *ast.SendStatement, env *object.Environment) object.Object {
 	body := Eval(node.Body, env)
-	if isError(body) {
+	if isInterrupt(body) {
 		return body
 	}
 
@@ -753,7 +2889,7 @@ func evalSendStatement(node *ast.SendStatement, env *object.Environment) object.
 	}
 
 	url := Eval(node.URL, env)
-	if isError(url) {
+	if isInterrupt(url) {
 		return url
 	}
 
@@ -765,7 +2901,7 @@ func evalSendStatement(node *ast.SendStatement, env *object.Environment) object.
 	var headers *object.List
 	if node.Headers != nil {
 		headersObj := Eval(node.Headers, env)
-		if isError(headersObj) {
+		if isInterrupt(headersObj) {
 			return headersObj
 		}
 		headers, ok = headersObj.(*object.List)
@@ -776,16 +2912,16 @@ func evalSendStatement(node *ast.SendStatement, env *object.Environment) object.
 
 	response, err := executeRequest("POST", urlStr.Value, bodyStr.Value, headers)
 	if err != nil {
-		return newError("send failed: %s", err.Error())
+		return newKindError(httpErrorKind, "send failed: %s", err.Error())
 	}
 
-	env.Set(node.Target.Value, response)
+	assign(env, node.Target, response)
 	return response
 }
 
 func evalPutStatement(node *ast.PutStatement, env *object.Environment) object.Object {
 	body := Eval(node.Body, env)
-	if isError(body) {
+	if isInterrupt(body) {
 		return body
 	}
 
@@ -795,7 +2931,7 @@ func evalPutStatement(node *ast.PutStatement, env *object.Environment) object.Ob
 	}
 
 	url := Eval(node.URL, env)
-	if isError(url) {
+	if isInterrupt(url) {
 		return url
 	}
 
@@ -807,7 +2943,7 @@ func evalPutStatement(node *ast.PutStatement, env *object.Environment) object.Ob
 	var headers *object.List
 	if node.Headers != nil {
 		headersObj := Eval(node.Headers, env)
-		if isError(headersObj) {
+		if isInterrupt(headersObj) {
 			return headersObj
 		}
 		headers, ok = headersObj.(*object.List)
@@ -818,16 +2954,16 @@ func evalPutStatement(node *ast.PutStatement, env *object.Environment) object.Ob
 
 	response, err := executeRequest("PUT", urlStr.Value, bodyStr.Value, headers)
 	if err != nil {
-		return newError("put failed: %s", err.Error())
+		return newKindError(httpErrorKind, "put failed: %s", err.Error())
 	}
 
-	env.Set(node.Target.Value, response)
+	assign(env, node.Target, response)
 	return response
 }
 
 func evalDeleteStatement(node *ast.DeleteStatement, env *object.Environment) object.Object {
 	url := Eval(node.URL, env)
-	if isError(url) {
+	if isInterrupt(url) {
 		return url
 	}
 
@@ -839,7 +2975,7 @@ func evalDeleteStatement(node *ast.DeleteStatement, env *object.Environment) obj
 	var headers *object.List
 	if node.Headers != nil {
 		headersObj := Eval(node.Headers, env)
-		if isError(headersObj) {
+		if isInterrupt(headersObj) {
 			return headersObj
 		}
 		headers, ok = headersObj.(*object.List)
@@ -850,16 +2986,16 @@ func evalDeleteStatement(node *ast.DeleteStatement, env *object.Environment) obj
 
 	response, err := executeRequest("DELETE", urlStr.Value, "", headers)
 	if err != nil {
-		return newError("delete failed: %s", err.Error())
+		return newKindError(httpErrorKind, "delete failed: %s", err.Error())
 	}
 
-	env.Set(node.Target.Value, response)
+	assign(env, node.Target, response)
 	return response
 }
 
 func evalBodyOfExpression(node *ast.BodyOfExpression, env *object.Environment) object.Object {
 	respObj := Eval(node.Response, env)
-	if isError(respObj) {
+	if isInterrupt(respObj) {
 		return respObj
 	}
 
@@ -876,7 +3012,7 @@ func evalBodyOfExpression(node *ast.BodyOfExpression, env *object.Environment) o
 
 func evalStatusOfExpression(node *ast.StatusOfExpression, env *object.Environment) object.Object {
 	respObj := Eval(node.Response, env)
-	if isError(respObj) {
+	if isInterrupt(respObj) {
 		return respObj
 	}
 
@@ -890,7 +3026,7 @@ func evalStatusOfExpression(node *ast.StatusOfExpression, env *object.Environmen
 
 func evalHeaderFromExpression(node *ast.HeaderFromExpression, env *object.Environment) object.Object {
 	headerName := Eval(node.HeaderName, env)
-	if isError(headerName) {
+	if isInterrupt(headerName) {
 		return headerName
 	}
 
@@ -900,7 +3036,7 @@ func evalHeaderFromExpression(node *ast.HeaderFromExpression, env *object.Enviro
 	}
 
 	respObj := Eval(node.Response, env)
-	if isError(respObj) {
+	if isInterrupt(respObj) {
 		return respObj
 	}
 
@@ -967,7 +3103,7 @@ func executeRequest(method, url, body string, headers *object.List) (*object.Res
 }
 
 func applyHeaders(req *http.Request, headers *object.List) {
-	for _, elem := range headers.Elements {
+	for _, elem := range headers.Snapshot() {
 		if str, ok := elem.(*object.String); ok {
 			parts := strings.SplitN(str.Value, ":", 2)
 			if len(parts) == 2 {
@@ -981,7 +3117,7 @@ func applyHeaders(req *http.Request, headers *object.List) {
 
 func evalParseJsonStatement(node *ast.ParseJsonStatement, env *object.Environment) object.Object {
 	source := Eval(node.Source, env)
-	if isError(source) {
+	if isInterrupt(source) {
 		return source
 	}
 
@@ -990,19 +3126,19 @@ func evalParseJsonStatement(node *ast.ParseJsonStatement, env *object.Environmen
 		return newError("parse json requires a string, got %s", source.Type())
 	}
 
-	var result interface{}
-	if err := json.Unmarshal([]byte(sourceStr.Value), &result); err != nil {
-		return newError("invalid JSON: %s", err.Error())
+	result, err := decodeJson(sourceStr.Value)
+	if err != nil {
+		return newKindError(jsonErrorKind, "invalid JSON: %s", err.Error())
 	}
 
 	jsonObj := &object.Json{Value: result}
-	env.Set(node.Target.Value, jsonObj)
+	assign(env, node.Target, jsonObj)
 	return jsonObj
 }
 
 func evalEncodeJsonStatement(node *ast.EncodeJsonStatement, env *object.Environment) object.Object {
 	source := Eval(node.Source, env)
-	if isError(source) {
+	if isInterrupt(source) {
 		return source
 	}
 
@@ -1015,31 +3151,31 @@ func evalEncodeJsonStatement(node *ast.EncodeJsonStatement, env *object.Environm
 		value = src.Value
 	case *object.Integer:
 		value = src.Value
+	case *object.Float:
+		value = src.Value
 	case *object.Boolean:
 		value = src.Value
 	case *object.List:
-		arr := make([]interface{}, len(src.Elements))
-		for i, elem := range src.Elements {
-			arr[i] = objectToInterface(elem)
-		}
-		value = arr
+		value = objectToInterface(src)
+	case *object.Dictionary:
+		value = objectToInterface(src)
 	default:
-		return newError("cannot encode %s as json", source.Type())
+		return newKindError(jsonErrorKind, "cannot encode %s as json", source.Type())
 	}
 
 	bytes, err := json.Marshal(value)
 	if err != nil {
-		return newError("json encoding failed: %s", err.Error())
+		return newKindError(jsonErrorKind, "json encoding failed: %s", err.Error())
 	}
 
 	result := &object.String{Value: string(bytes)}
-	env.Set(node.Target.Value, result)
+	assign(env, node.Target, result)
 	return result
 }
 
 func evalFieldFromExpression(node *ast.FieldFromExpression, env *object.Environment) object.Object {
 	fieldName := Eval(node.FieldName, env)
-	if isError(fieldName) {
+	if isInterrupt(fieldName) {
 		return fieldName
 	}
 
@@ -1049,21 +3185,38 @@ func evalFieldFromExpression(node *ast.FieldFromExpression, env *object.Environm
 	}
 
 	source := Eval(node.Source, env)
-	if isError(source) {
+	if isInterrupt(source) {
 		return source
 	}
 
-	jsonObj, ok := source.(*object.Json)
-	if !ok {
-		return newError("field from requires a json object, got %s", source.Type())
+	switch src := source.(type) {
+	case *object.Json:
+		return getJsonField(src.Value, fieldStr.Value)
+	case *object.Dictionary:
+		return getDictionaryField(src, fieldStr.Value)
+	default:
+		return newError("field from requires a json object or dictionary, got %s", source.Type())
 	}
-
-	result := getJsonField(jsonObj.Value, fieldStr.Value)
-	return result
 }
 
 // JSON Helper Functions
 
+// decodeJson parses a JSON document keeping numbers as json.Number, so
+// integers and decimals survive the round trip without losing precision
+func decodeJson(source string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(source))
+	decoder.UseNumber()
+
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return result, nil
+}
+
 func getJsonField(data interface{}, path string) object.Object {
 	parts := strings.Split(path, ".")
 	current := data
@@ -1084,14 +3237,49 @@ func getJsonField(data interface{}, path string) object.Object {
 	return interfaceToObject(current)
 }
 
+// getDictionaryField follows a dotted path through nested dictionaries,
+// continuing into json values stored inside them
+func getDictionaryField(dict *object.Dictionary, path string) object.Object {
+	key, rest, nested := strings.Cut(path, ".")
+
+	value, ok := dict.Get(key)
+	if !ok {
+		return NULL
+	}
+	if !nested {
+		return value
+	}
+
+	switch v := value.(type) {
+	case *object.Dictionary:
+		return getDictionaryField(v, rest)
+	case *object.Json:
+		return getJsonField(v.Value, rest)
+	default:
+		return NULL
+	}
+}
+
 func interfaceToObject(val interface{}) object.Object {
 	switch v := val.(type) {
 	case nil:
 		return NULL
 	case bool:
 		return nativeBoolToBooleanObject(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return &object.Integer{Value: i}
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return NULL
+		}
+		return &object.Float{Value: f}
 	case float64:
-		return &object.Integer{Value: int64(v)}
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return &object.Integer{Value: int64(v)}
+		}
+		return &object.Float{Value: v}
 	case string:
 		return &object.String{Value: v}
 	case []interface{}:
@@ -1111,6 +3299,8 @@ func objectToInterface(obj object.Object) interface{} {
 	switch o := obj.(type) {
 	case *object.Integer:
 		return o.Value
+	case *object.Float:
+		return o.Value
 	case *object.String:
 		return o.Value
 	case *object.Boolean:
@@ -1118,11 +3308,19 @@ func objectToInterface(obj object.Object) interface{} {
 	case *object.Null:
 		return nil
 	case *object.List:
-		arr := make([]interface{}, len(o.Elements))
-		for i, elem := range o.Elements {
+		elements := o.Snapshot()
+		arr := make([]interface{}, len(elements))
+		for i, elem := range elements {
 			arr[i] = objectToInterface(elem)
 		}
 		return arr
+	case *object.Dictionary:
+		keys, values := o.Entries()
+		pairs := &orderedPairs{keys: keys, values: make([]interface{}, len(keys))}
+		for i, value := range values {
+			pairs.values[i] = objectToInterface(value)
+		}
+		return pairs
 	case *object.Json:
 		return o.Value
 	default:
@@ -1130,6 +3328,35 @@ func objectToInterface(obj object.Object) interface{} {
 	}
 }
 
+// orderedPairs encodes a dictionary as a JSON object, keeping its key order
+type orderedPairs struct {
+	keys   []string
+	values []interface{}
+}
+
+func (op *orderedPairs) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, key := range op.keys {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		keyBytes, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		valueBytes, err := json.Marshal(op.values[i])
+		if err != nil {
+			return nil, err
+		}
+		out.Write(keyBytes)
+		out.WriteString(":")
+		out.Write(valueBytes)
+	}
+	out.WriteString("}")
+	return out.Bytes(), nil
+}
+
 // === Web Server Implementation ===
 
 // ServerInfo holds information about a running server
@@ -1160,7 +3387,7 @@ var (
 // evalServeStatement starts an HTTP server
 func evalServeStatement(node *ast.ServeStatement, env *object.Environment) object.Object {
 	portObj := Eval(node.Port, env)
-	if isError(portObj) {
+	if isInterrupt(portObj) {
 		return portObj
 	}
 
@@ -1237,7 +3464,7 @@ func evalServeStatement(node *ast.ServeStatement, env *object.Environment) objec
 // evalWhenRouteStatement registers an inline route handler
 func evalWhenRouteStatement(node *ast.WhenRouteStatement, env *object.Environment) object.Object {
 	pathObj := Eval(node.Path, env)
-	if isError(pathObj) {
+	if isInterrupt(pathObj) {
 		return pathObj
 	}
 
@@ -1266,10 +3493,10 @@ func evalWhenRouteStatement(node *ast.WhenRouteStatement, env *object.Environmen
 	return NULL
 }
 
-// evalRouteToStatement registers a function reference as route handler
+// evalRouteToStatement registers a function as route handler
 func evalRouteToStatement(node *ast.RouteToStatement, env *object.Environment) object.Object {
 	pathObj := Eval(node.Path, env)
-	if isError(pathObj) {
+	if isInterrupt(pathObj) {
 		return pathObj
 	}
 
@@ -1278,14 +3505,9 @@ func evalRouteToStatement(node *ast.RouteToStatement, env *object.Environment) o
 		return newError("route path must be a string, got %s", pathObj.Type())
 	}
 
-	fnObj, ok := env.Get(node.Handler.Value)
-	if !ok {
-		return newError("handler function not defined: %s", node.Handler.Value)
-	}
-
-	fn, ok := fnObj.(*object.Function)
-	if !ok {
-		return newError("%s is not a function", node.Handler.Value)
+	fn, errObj := evalFunctionValue(node.Handler, env)
+	if errObj != nil {
+		return errObj
 	}
 
 	handler := RouteHandler{
@@ -1305,7 +3527,7 @@ func evalRouteToStatement(node *ast.RouteToStatement, env *object.Environment) o
 // evalReplyStatement creates a response object
 func evalReplyStatement(node *ast.ReplyStatement, env *object.Environment) object.Object {
 	bodyObj := Eval(node.Body, env)
-	if isError(bodyObj) {
+	if isInterrupt(bodyObj) {
 		return bodyObj
 	}
 
@@ -1316,7 +3538,7 @@ func evalReplyStatement(node *ast.ReplyStatement, env *object.Environment) objec
 		// Auto-encode body as JSON
 		jsonBytes, err := json.Marshal(objectToInterface(bodyObj))
 		if err != nil {
-			return newError("failed to encode as JSON: %s", err)
+			return newKindError(jsonErrorKind, "failed to encode as JSON: %s", err)
 		}
 		bodyStr = string(jsonBytes)
 		headers["Content-Type"] = "application/json"
@@ -1327,6 +3549,12 @@ func evalReplyStatement(node *ast.ReplyStatement, env *object.Environment) objec
 		case *object.Json:
 			jsonBytes, _ := json.Marshal(b.Value)
 			bodyStr = string(jsonBytes)
+		case *object.Dictionary:
+			jsonBytes, err := json.Marshal(objectToInterface(b))
+			if err != nil {
+				return newKindError(jsonErrorKind, "failed to encode as JSON: %s", err)
+			}
+			bodyStr = string(jsonBytes)
 		default:
 			bodyStr = bodyObj.Inspect()
 		}
@@ -1335,7 +3563,7 @@ func evalReplyStatement(node *ast.ReplyStatement, env *object.Environment) objec
 	statusCode := 200
 	if node.StatusCode != nil {
 		statusObj := Eval(node.StatusCode, env)
-		if isError(statusObj) {
+		if isInterrupt(statusObj) {
 			return statusObj
 		}
 		if sc, ok := statusObj.(*object.Integer); ok {
@@ -1368,7 +3596,7 @@ func evalStopServerStatement(node *ast.StopServerStatement, env *object.Environm
 
 	if node.Port != nil {
 		portObj := Eval(node.Port, env)
-		if isError(portObj) {
+		if isInterrupt(portObj) {
 			return portObj
 		}
 
@@ -1412,7 +3640,7 @@ func evalStopServerStatement(node *ast.StopServerStatement, env *object.Environm
 // evalMethodOfExpression extracts method from request
 func evalMethodOfExpression(node *ast.MethodOfExpression, env *object.Environment) object.Object {
 	reqObj := Eval(node.Request, env)
-	if isError(reqObj) {
+	if isInterrupt(reqObj) {
 		return reqObj
 	}
 
@@ -1427,7 +3655,7 @@ func evalMethodOfExpression(node *ast.MethodOfExpression, env *object.Environmen
 // evalPathOfExpression extracts path from request
 func evalPathOfExpression(node *ast.PathOfExpression, env *object.Environment) object.Object {
 	reqObj := Eval(node.Request, env)
-	if isError(reqObj) {
+	if isInterrupt(reqObj) {
 		return reqObj
 	}
 
@@ -1442,7 +3670,7 @@ func evalPathOfExpression(node *ast.PathOfExpression, env *object.Environment) o
 // evalQueryFromExpression extracts query parameter from request
 func evalQueryFromExpression(node *ast.QueryFromExpression, env *object.Environment) object.Object {
 	queryName := Eval(node.QueryName, env)
-	if isError(queryName) {
+	if isInterrupt(queryName) {
 		return queryName
 	}
 
@@ -1452,7 +3680,7 @@ func evalQueryFromExpression(node *ast.QueryFromExpression, env *object.Environm
 	}
 
 	reqObj := Eval(node.Request, env)
-	if isError(reqObj) {
+	if isInterrupt(reqObj) {
 		return reqObj
 	}
 
@@ -1502,15 +3730,12 @@ func handleIncomingRequest(w http.ResponseWriter, r *http.Request, port int, env
 			var result object.Object
 
 			if route.HandlerFn != nil {
-				// Function reference handler
-				extendedEnv := object.NewEnclosedEnvironment(route.HandlerFn.Env)
+				// Function handler, passed the request if it takes a parameter
+				args := []object.Object{}
 				if len(route.HandlerFn.Parameters) > 0 {
-					extendedEnv.Set(route.HandlerFn.Parameters[0].Value, reqObj)
-				}
-				result = Eval(route.HandlerFn.Body, extendedEnv)
-				if returnValue, ok := result.(*object.ReturnValue); ok {
-					result = returnValue.Value
+					args = append(args, reqObj)
 				}
+				result = applyFunction(route.HandlerFn, args)
 			} else {
 				// Inline block handler
 				handlerScope := object.NewEnclosedEnvironment(route.HandlerEnv)
@@ -1533,6 +3758,14 @@ func handleIncomingRequest(w http.ResponseWriter, r *http.Request, port int, env
 				return
 			}
 
+			// Uncaught errors are server failures
+			if errObj, ok := result.(*object.Error); ok {
+				fmt.Printf("%s %s failed at line %d: %s\n", r.Method, r.URL.Path, errObj.Line, errObj.Message)
+				w.WriteHeader(500)
+				w.Write([]byte(errObj.Inspect()))
+				return
+			}
+
 			// Default response for non-reply returns
 			w.WriteHeader(200)
 			if result != nil {
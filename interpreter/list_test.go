@@ -0,0 +1,18 @@
+package interpreter
+
+import (
+	"az-lang/object"
+	"testing"
+)
+
+func TestEmptyListSummaries(t *testing.T) {
+	for _, summary := range []string{"average", "max", "min", "maximum", "minimum"} {
+		expression := "the " + summary + ` of ("" as a list)`
+		t.Run(summary, func(t *testing.T) {
+			got := evalValue(t, expression)
+			if err, ok := got.(*object.Error); !ok || err.Kind != mathErrorKind {
+				t.Errorf("%s gave %s, want a math error", expression, got.Inspect())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package interpreter
+
+import (
+	"az-lang/lexer"
+	"az-lang/object"
+	"az-lang/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeFiles writes each file to a new directory and returns its path
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// runFile runs the script at path the way abc does
+func runFile(t *testing.T, path string) (*object.Environment, object.Object) {
+	t.Helper()
+	source, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%s: parser errors: %v", path, p.Errors())
+	}
+	env := object.NewFileEnvironment(path)
+	return env, Eval(program, env)
+}
+
+func TestUseReadsCurrentExports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"counter.abc": `
+set count to 0
+to tick
+    increase count by 1
+done
+export count and tick
+`,
+		"main.abc": `
+use "counter.abc"
+set before to count
+call tick
+call tick
+set after to count
+to read_count
+    return count
+done
+set in_function to call read_count
+`,
+	})
+
+	env, result := runFile(t, filepath.Join(dir, "main.abc"))
+	if err, ok := result.(*object.Error); ok {
+		t.Fatalf("script failed: %s", err.Message)
+	}
+	for name, want := range map[string]string{"before": "0", "after": "2", "in_function": "2"} {
+		if got, _ := env.Get(name); got == nil || got.Inspect() != want {
+			t.Errorf("%s is %v, want %s", name, got, want)
+		}
+	}
+}
+
+func TestUseCannotChangeExports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"counter.abc": "set count to 0\nexport count\n",
+		"main.abc":    "use \"counter.abc\"\nincrease count by 1\n",
+	})
+
+	_, result := runFile(t, filepath.Join(dir, "main.abc"))
+	err, ok := result.(*object.Error)
+	if !ok || !strings.Contains(err.Message, "only the module can change it") {
+		t.Errorf("got %v, want an error saying only the module can change count", result)
+	}
+}
+
+func TestModuleLoadsOnceAcrossScripts(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shared.abc": "set items to a list of 1\nexport items\n",
+		"main.abc":   "use \"shared.abc\"\n",
+	})
+
+	const scripts = 20
+	loaded := make([]*object.Module, scripts)
+	var wg sync.WaitGroup
+	for i := 0; i < scripts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mod, err := loadModule(filepath.Join(dir, "shared.abc"), filepath.Join(dir, "main.abc"))
+			if err != nil {
+				t.Errorf("script %d: %s", i, err.Inspect())
+				return
+			}
+			loaded[i] = mod
+		}(i)
+	}
+	wg.Wait()
+
+	for i, mod := range loaded {
+		if mod != loaded[0] {
+			t.Fatalf("script %d got a different copy of the module", i)
+		}
+	}
+}
+
+func TestCircularUse(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.abc": "use \"a.abc\"\n",
+		"a.abc":    "use \"b.abc\"\n",
+		"b.abc":    "use \"a.abc\"\n",
+	})
+
+	_, result := runFile(t, filepath.Join(dir, "main.abc"))
+	err, ok := result.(*object.Error)
+	if !ok || err.Message != "circular use: a.abc → b.abc → a.abc" {
+		t.Errorf("got %v, want a circular use error", result)
+	}
+}
+
+func TestUseOnlyAtTopLevel(t *testing.T) {
+	tests := []string{
+		"if true then\n    use \"a.abc\"\ndone",
+		"try\n    use \"a.abc\"\ndone",
+		"try\n    set x to 1\nif it fails\n    export x\ndone",
+	}
+
+	for _, source := range tests {
+		p := parser.New(lexer.New(source))
+		p.ParseProgram()
+		if len(p.Errors()) != 1 || !strings.Contains(p.Errors()[0], "must be at the top level") {
+			t.Errorf("%q gave errors %v, want one top level error", source, p.Errors())
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package interpreter
+
+import (
+	"az-lang/ast"
+	"az-lang/lexer"
+	"az-lang/object"
+	"az-lang/parser"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveScript runs source, leaving out any "serve" statements, and serves
+// the request handlers it registers from a test server
+func serveScript(t *testing.T, source string) (*httptest.Server, *object.Environment) {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if _, ok := stmt.(*ast.ServeStatement); !ok {
+			statements = append(statements, stmt)
+		}
+	}
+	program.Statements = statements
+
+	// Routes are registered to the default port until a server starts
+	registryMu.Lock()
+	port := defaultPort
+	delete(routeRegistry, port)
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(routeRegistry, port)
+		registryMu.Unlock()
+	})
+
+	env := object.NewEnvironment()
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		t.Fatalf("script failed: %s at line %d", err.Message, err.Line)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleIncomingRequest(w, r, port, env)
+	}))
+	t.Cleanup(server.Close)
+	return server, env
+}
+
+// request sends a request to the test server and returns the status and body
+func request(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+// replyScript gives each handler a way to show that code after its reply
+// ran: anything that does increases the top-level count "after"
+const replyScript = `
+set after to 0
+
+when send at "/validate" using req do
+    parse body of req as json into input
+    set name to field "name" from input
+    if name equals null then
+        reply with "name is required" with status 400
+        increase after by 1
+    done
+    increase after by 1
+    reply with "hello {name}" with status 201
+done
+
+when fetch at "/loops" do
+    set outer to 0
+    while outer is less than 3 do
+        for each n in a list of 1 and 2 and 3 do
+            repeat 2 times do
+                if n equals 2 then
+                    reply with "found {outer} {n}"
+                done
+                increase after by 1
+            done
+        done
+        increase outer by 1
+    done
+    increase after by 100
+    reply with "not found" with status 404
+done
+
+when fetch at "/check" do
+    check 404:
+        when 200 then
+            reply with "ok"
+        when 400 to 499 then
+            reply with "client error" with status 418
+            increase after by 1
+        otherwise
+            reply with "other"
+    done
+    increase after by 1
+    reply with "after check"
+done
+
+when fetch at "/try" do
+    try
+        reply with "from try" with status 202
+        increase after by 1
+    if it fails with problem
+        increase after by 1
+        reply with "caught" with status 500
+    done
+    increase after by 1
+    reply with "after try"
+done
+
+to require_admin with role
+    if role does not equal "admin" then
+        reply with "forbidden" with status 403
+    done
+    increase after by 1
+    return true
+done
+
+to guard with role
+    require_admin with role
+    increase after by 1
+    return true
+done
+
+when fetch at "/function" using req do
+    guard with query "role" from req
+    increase after by 1
+    reply with "welcome"
+done
+
+when fetch at "/first" do
+    reply with "first"
+    reply with "second"
+done
+
+when fetch at "/counting" do
+    for each n from 1 to 10 do
+        if n equals 4 then
+            reply with "stopped at {n}"
+        done
+        increase after by 1
+    done
+    increase after by 100
+    reply with "done"
+done
+`
+
+func TestReplyEndsHandler(t *testing.T) {
+	server, env := serveScript(t, replyScript)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+		wantAfter  int64 // how often code after the reply may run
+	}{
+		{"reply inside if", "POST", "/validate", `{"other": 1}`, 400, "name is required", 0},
+		{"no early reply", "POST", "/validate", `{"name": "Ada"}`, 201, "hello Ada", 1},
+		{"reply inside nested loops", "GET", "/loops", "", 200, "found 0 2", 2},
+		{"reply inside check", "GET", "/check", "", 418, "client error", 0},
+		{"reply inside try", "GET", "/try", "", 202, "from try", 0},
+		{"reply inside called functions", "GET", "/function?role=guest", "", 403, "forbidden", 0},
+		{"called functions without a reply", "GET", "/function?role=admin", "", 200, "welcome", 3},
+		{"first reply wins", "GET", "/first", "", 200, "first", 0},
+		{"reply inside counting loop", "GET", "/counting", "", 200, "stopped at 4", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env.Set("after", &object.Integer{Value: 0})
+
+			status, body := request(t, tt.method, server.URL+tt.path, tt.body)
+			if status != tt.wantStatus || body != tt.wantBody {
+				t.Errorf("got %d %q, want %d %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+
+			after, _ := env.Get("after")
+			if count, ok := after.(*object.Integer); !ok || count.Value != tt.wantAfter {
+				t.Errorf("code after the reply ran: after is %s, want %d", after.Inspect(), tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestUncaughtErrorRepliesWith500(t *testing.T) {
+	server, _ := serveScript(t, `
+when fetch at "/fail" do
+    set x to 1 divided by 0
+    reply with "unreachable"
+done
+`)
+
+	status, body := request(t, "GET", server.URL+"/fail", "")
+	if status != 500 || !strings.Contains(body, "division by zero") {
+		t.Errorf("got %d %q, want 500 with a division by zero error", status, body)
+	}
+}
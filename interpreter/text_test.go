@@ -0,0 +1,160 @@
+package interpreter
+
+import (
+	"az-lang/lexer"
+	"az-lang/object"
+	"az-lang/parser"
+	"strings"
+	"testing"
+)
+
+// evalValue evaluates a single expression and returns its value
+func evalValue(t *testing.T, expression string) object.Object {
+	t.Helper()
+
+	p := parser.New(lexer.New("set result to " + expression))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%s: parser errors: %v", expression, p.Errors())
+	}
+
+	env := object.NewEnvironment()
+	if err, ok := Eval(program, env).(*object.Error); ok {
+		return err
+	}
+	result, _ := env.Get("result")
+	return result
+}
+
+// textCase is an expression and what it gives, written the way say would
+type textCase struct {
+	expression string
+	want       string
+}
+
+func runTextCases(t *testing.T, tests []textCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got := evalValue(t, tt.expression)
+			if err, ok := got.(*object.Error); ok {
+				t.Fatalf("got error %q, want %q", err.Message, tt.want)
+			}
+			if got.Inspect() != tt.want {
+				t.Errorf("got %q, want %q", got.Inspect(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAndJoin(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`split "a,b,,c" by ","`, "[a, b, , c]"},
+		{`split "a--b--c" by "--"`, "[a, b, c]"},
+		{`split "" by ","`, "[]"},
+		{`split "héllo" by ""`, "[h, é, l, l, o]"},
+		{`split "a👍🏽b" by ""`, "[a, 👍🏽, b]"},
+		{`split "he\u{301}y" by ""`, "[h, é, y]"},
+		{`join (a list of "a" and "b") with " / "`, "a / b"},
+		{`join (a list of 1 and 2.5 and true) with ", "`, "1, 2.5, true"},
+		{`join (a list of "x" and "y")`, "xy"},
+		{`join (split "a b c" by " ") with "-"`, "a-b-c"},
+	})
+}
+
+func TestLetterCaseAndTrim(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`uppercase of "héllo"`, "HÉLLO"},
+		{`lowercase of "ÉCOLE"`, "école"},
+		{`uppercase of "👍🏽 ok"`, "👍🏽 OK"},
+		{`trim "  x y  "`, "x y"},
+		{`trim "\t\n x \r\n"`, "x"},
+		{`trim ""`, ""},
+	})
+}
+
+func TestReplace(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`replace "a" with "o" in "banana"`, "bonono"},
+		{`replace "z" with "o" in "banana"`, "banana"},
+		{`replace "é" with "e" in "héllé"`, "helle"},
+		{`replace "👍🏽" with "+1" in "ok 👍🏽"`, "ok +1"},
+		{`replace pattern "\d+" with "#" in "a1b22"`, "a#b#"},
+	})
+}
+
+func TestPosition(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`position of "l" in "héllo"`, "3"},
+		{`position of "é" in "héllo"`, "2"},
+		{`position of "e\u{301}" in "he\u{301}llo"`, "2"},
+		{`position of "llo" in "he\u{301}llo"`, "3"},
+		{`position of "🇬🇧" in "a👍🏽🇬🇧"`, "3"},
+		{`position of "z" in "abc"`, "0"},
+		{`position of 3 in a list of 1 and 2 and 3`, "3"},
+		{`position of "x" in a list of "a" and "b"`, "0"},
+	})
+}
+
+func TestCharacters(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`characters 2 to 4 of "héllo"`, "éll"},
+		{`characters 1 to 1 of "héllo"`, "h"},
+		{`characters minus 3 to minus 1 of "héllo"`, "llo"},
+		{`characters 2 to 2 of "he\u{301}llo"`, "é"},
+		{`characters 2 to 3 of "a👍🏽🇬🇧"`, "👍🏽🇬🇧"},
+		{`characters minus 1 to minus 1 of "a👍🏽🇬🇧"`, "🇬🇧"},
+		{`characters 3 to 1 of "abc"`, ""},
+	})
+}
+
+func TestRepeatedAndPad(t *testing.T) {
+	runTextCases(t, []textCase{
+		{`"-" repeated 3 times`, "---"},
+		{`"ab" repeated 0 times`, ""},
+		{`"👍🏽" repeated 2 times`, "👍🏽👍🏽"},
+		{`"-" repeated (1 plus 2) times`, "---"},
+		{`pad "7" to 3 with "0" on the left`, "007"},
+		{`pad "ab" to 4`, "ab  "},
+		{`pad "ab" to 4 on the right`, "ab  "},
+		{`pad "é" to 3 with "*" on the left`, "**é"},
+		{`pad "👍🏽" to 3 with "-"`, "👍🏽--"},
+		{`pad "he\u{301}" to 3 with "."`, "hé."},
+		{`pad "x" to 3 with "👍🏽"`, "x👍🏽👍🏽"},
+		{`pad "hello" to 2`, "hello"},
+		{`pad "abc" to 0`, "abc"},
+	})
+}
+
+func TestTextOperationErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{`characters 0 to 2 of "abc"`, "the first item is item 1"},
+		{`characters 2 to 9 of "abc"`, "out of bounds (text has 3 characters)"},
+		{`characters minus 9 to 1 of "abc"`, "out of bounds"},
+		{`characters 2 to 3 of "👍🏽🇬🇧"`, "out of bounds (text has 2 characters)"},
+		{`"ab" repeated minus 1 times`, "whole number of times, got -1"},
+		{`"ab" repeated 1.5 times`, "whole number of times"},
+		{`pad "a" to minus 3`, "whole number of characters, got -3"},
+		{`pad "a" to 3 with "xy"`, "single character"},
+		{`pad "a" to 3 with ""`, "single character"},
+		{`split 5 by ","`, "split requires text"},
+		{`uppercase of 5`, "requires text"},
+		{`trim (a list of 1)`, "requires text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got := evalValue(t, tt.expression)
+			err, ok := got.(*object.Error)
+			if !ok {
+				t.Fatalf("got %s, want an error containing %q", got.Inspect(), tt.want)
+			}
+			if !strings.Contains(err.Message, tt.want) {
+				t.Errorf("got error %q, want one containing %q", err.Message, tt.want)
+			}
+		})
+	}
+}
@@ -2,32 +2,46 @@ package lexer
 
 import (
 	"az-lang/token"
+	"fmt"
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	position     int  // current byte position in input (points to current char)
+	readPosition int  // current reading byte position in input (after current char)
+	ch           rune // current char under examination
 	line         int
 	column       int
+	errors       []string
+	afterPattern bool // the last token was the word "pattern"
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input, line: 1, column: 0}
+	return NewAt(input, 1, 0)
+}
+
+// NewAt creates a lexer for source that starts at the given line and column
+// of a larger file, such as an expression inside an interpolated string
+func NewAt(input string, line, column int) *Lexer {
+	l := &Lexer{input: input, line: line, column: column}
 	l.readChar()
 	return l
 }
 
+// readChar advances one character (a full UTF-8 encoded rune, not a byte)
 func (l *Lexer) readChar() {
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
 	l.column++
 
 	if l.ch == '\n' {
@@ -36,28 +50,40 @@ func (l *Lexer) readChar() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
+}
+
+// Errors returns problems found while tokenizing, such as an unterminated
+// block comment
+func (l *Lexer) Errors() []string {
+	return l.errors
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	l.skipWhitespaceAndComments()
 
 	tok.Line = l.line
 	tok.Column = l.column
 
+	afterPattern := l.afterPattern
+	l.afterPattern = false
+
 	switch {
 	case l.ch == 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
+	case l.ch == '"' && afterPattern:
+		tok.Type, tok.Literal = l.readPatternString()
+		return tok
 	case l.ch == '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Type, tok.Literal = l.readString()
 		return tok
 	case isDigit(l.ch):
 		tok.Literal = l.readNumber()
@@ -66,7 +92,18 @@ func (l *Lexer) NextToken() token.Token {
 	case isLetter(l.ch):
 		tok.Literal = l.readIdentifier()
 		tok.Type = token.LookupIdent(tok.Literal)
+		l.afterPattern = tok.Literal == "pattern"
 		return tok
+	case l.ch == ':':
+		tok = newToken(token.COLON, l.ch, l.line, l.column)
+	case l.ch == '(':
+		tok = newToken(token.LPAREN, l.ch, l.line, l.column)
+	case l.ch == ')':
+		tok = newToken(token.RPAREN, l.ch, l.line, l.column)
+	case l.ch == '\'' && l.startsPossessive():
+		tok.Type = token.POSSESSIVE
+		tok.Literal = "'s"
+		l.readChar() // consume the apostrophe, leaving s to be consumed below
 	default:
 		tok = newToken(token.ILLEGAL, l.ch, l.line, l.column)
 	}
@@ -81,9 +118,74 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skipWhitespaceAndComments skips whitespace and every comment form:
+//
+//	# line comment
+//	note: line comment, only as the first text on a line
+//	### block comment, which may span lines ###
+func (l *Lexer) skipWhitespaceAndComments() {
+	for {
+		l.skipWhitespace()
+
+		switch {
+		case l.startsWith("###") && !l.startsWith("####"):
+			l.skipBlockComment()
+		case l.ch == '#':
+			l.skipLineComment()
+		case (l.startsWith("note:") || l.startsWith("Note:")) && l.atLineStart():
+			l.skipLineComment()
+		default:
+			return
+		}
+	}
+}
+
+// atLineStart reports whether only spaces and tabs come before the current
+// char on its line, so that "check note:" still reads note as a name
+func (l *Lexer) atLineStart() bool {
+	lineStart := strings.LastIndexByte(l.input[:l.position], '\n') + 1
+	return strings.TrimLeft(l.input[lineStart:l.position], " \t\r") == ""
+}
+
+// startsWith reports whether the input at the current char begins with prefix
+func (l *Lexer) startsWith(prefix string) bool {
+	if l.position >= len(l.input) {
+		return false
+	}
+	return strings.HasPrefix(l.input[l.position:], prefix)
+}
+
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+func (l *Lexer) skipBlockComment() {
+	startLine := l.line
+
+	for i := 0; i < 3; i++ {
+		l.readChar()
+	}
+
+	for !l.startsWith("###") {
+		if l.ch == 0 {
+			l.errors = append(l.errors, fmt.Sprintf("line %d: unterminated block comment", startLine))
+			return
+		}
+		l.readChar()
+	}
+
+	for i := 0; i < 3; i++ {
+		l.readChar()
+	}
+}
+
+// readIdentifier reads a name such as count, café or 名前. After the first
+// letter a name may also contain digits, underscores and combining marks.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) || unicode.IsMark(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
@@ -94,35 +196,346 @@ func (l *Lexer) readNumber() string {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	// Decimal part: only when the dot is followed by a digit
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	// Skip opening quote
-	l.readChar()
+// startsPossessive reports whether the apostrophe at the current position
+// begins the 's of "auth's check_token"
+func (l *Lexer) startsPossessive() bool {
+	if !l.startsWith("'s") {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(l.input[l.readPosition+1:])
+	return !isLetter(next) && !isDigit(next)
+}
+
+// readString reads a quoted string, either "single line" or a """triple
+// quoted""" string that may span lines. Plain strings come back decoded as
+// STRING tokens; strings with {expressions} inside come back raw, with
+// their opening quotes, as TEMPLATE tokens, to be split by the parser with
+// SplitTemplate.
+func (l *Lexer) readString() (token.TokenType, string) {
+	return l.scanString(false)
+}
+
+// readPatternString reads the string after the word "pattern" as written,
+// so that backslashes and braces keep their meaning in the regular
+// expression. Only \" is decoded, to allow a quote in a pattern.
+func (l *Lexer) readPatternString() (token.TokenType, string) {
+	return l.scanString(true)
+}
+
+func (l *Lexer) scanString(pattern bool) (token.TokenType, string) {
+	startLine := l.line
+	start := l.position
+	delimiter := `"`
+	if l.startsWith(`"""`) {
+		delimiter = `"""`
+	}
+
+	// Skip opening quotes
+	for range delimiter {
+		l.readChar()
+	}
+
+	// A triple quoted string may start on the line after its opening quotes
+	if delimiter == `"""` {
+		if l.ch == '\r' && l.peekChar() == '\n' {
+			l.readChar()
+		}
+		if l.ch == '\n' {
+			l.readChar()
+		}
+	}
 
 	position := l.position
-	for l.ch != '"' && l.ch != 0 {
+	template := false
+	for !l.startsWith(delimiter) {
+		switch {
+		case l.ch == 0:
+			l.errors = append(l.errors, fmt.Sprintf("line %d: unterminated string", startLine))
+			return token.STRING, ""
+		case l.ch == '\\':
+			l.readChar()
+			if l.ch == 'u' && l.peekChar() == '{' {
+				// The braces of \u{...} never start an interpolation
+				for l.ch != '}' && l.ch != 0 && !l.startsWith(delimiter) {
+					l.readChar()
+				}
+			}
+			if l.ch != 0 {
+				l.readChar()
+			}
+		case l.ch == '{' && !pattern && startsInterpolation(l.peekChar()):
+			template = true
+			l.skipInterpolation()
+		default:
+			l.readChar()
+		}
+	}
+	raw := l.input[position:l.position]
+	opened := l.input[start:l.position]
+
+	// Skip closing quotes
+	for range delimiter {
 		l.readChar()
 	}
-	str := l.input[position:l.position]
 
-	// Skip closing quote
-	if l.ch == '"' {
+	if template {
+		return token.TEMPLATE, opened
+	}
+	if pattern {
+		return token.STRING, strings.ReplaceAll(raw, `\"`, `"`)
+	}
+
+	str, err := decodeEscapes(raw)
+	if err != nil {
+		l.errors = append(l.errors, fmt.Sprintf("line %d: %s",
+			startLine+strings.Count(raw[:err.offset], "\n"), err.message))
+	}
+	return token.STRING, str
+}
+
+// skipInterpolation moves past a {expression} inside a string, allowing
+// nested braces and quoted strings within the expression
+func (l *Lexer) skipInterpolation() {
+	depth := 0
+	for l.ch != 0 {
+		switch l.ch {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				l.readChar()
+				return
+			}
+		case '"':
+			l.readChar()
+			for l.ch != '"' && l.ch != 0 {
+				if l.ch == '\\' {
+					l.readChar()
+				}
+				l.readChar()
+			}
+		}
 		l.readChar()
 	}
+}
+
+// startsInterpolation reports whether a '{' followed by ch opens an
+// interpolated expression. Braces followed by a quote, space or another
+// brace, as in JSON text, stay literal.
+func startsInterpolation(ch rune) bool {
+	return isLetter(ch) || isDigit(ch)
+}
+
+// TemplatePart is a piece of an interpolated string: either literal text or
+// the source of an expression written between braces
+type TemplatePart struct {
+	Text   string
+	Code   string
+	IsCode bool
+	Line   int // lines from the opening quotes to this part
+	Column int // column of an expression's first character
+}
+
+// SplitTemplate splits a TEMPLATE token into text and expression parts,
+// decoding escape sequences in the text. column is where the opening quotes
+// are, so that each expression can be given its place in the file.
+func SplitTemplate(literal string, column int) ([]TemplatePart, error) {
+	raw := trimOpeningQuotes(literal)
+	opening := literal[:len(literal)-len(raw)]
+
+	// position returns the line and column of byte i of raw, counting lines
+	// from the opening quotes
+	position := func(i int) (int, int) {
+		before := opening + raw[:i]
+		lineStart := strings.LastIndexByte(before, '\n') + 1
+		if lineStart == 0 {
+			return 0, column + utf8.RuneCountInString(before)
+		}
+		return strings.Count(before, "\n"), utf8.RuneCountInString(before[lineStart:]) + 1
+	}
+
+	parts := []TemplatePart{}
+	textStart := 0
+
+	addText := func(end int) error {
+		if end == textStart {
+			return nil
+		}
+		text, err := decodeEscapes(raw[textStart:end])
+		if err != nil {
+			return fmt.Errorf("%s", err.message)
+		}
+		line, _ := position(textStart)
+		parts = append(parts, TemplatePart{Text: text, Line: line})
+		return nil
+	}
+
+	for i := 0; i < len(raw); i++ {
+		switch {
+		case raw[i] == '\\':
+			i++
+			if strings.HasPrefix(raw[i:], "u{") {
+				if end := strings.IndexByte(raw[i:], '}'); end >= 0 {
+					i += end
+				}
+			}
+		case raw[i] == '{' && i+1 < len(raw) && startsInterpolation(nextRune(raw, i+1)):
+			if err := addText(i); err != nil {
+				return nil, err
+			}
+			end := matchingBrace(raw, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { in string")
+			}
+			line, column := position(i + 1)
+			parts = append(parts, TemplatePart{
+				Code:   raw[i+1 : end],
+				IsCode: true,
+				Line:   line,
+				Column: column,
+			})
+			i = end
+			textStart = end + 1
+		}
+	}
+
+	if err := addText(len(raw)); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// trimOpeningQuotes removes the opening quotes from a TEMPLATE token, along
+// with the newline that may follow triple quotes
+func trimOpeningQuotes(literal string) string {
+	if raw, ok := strings.CutPrefix(literal, `"""`); ok {
+		if rest, ok := strings.CutPrefix(raw, "\r\n"); ok {
+			return rest
+		}
+		return strings.TrimPrefix(raw, "\n")
+	}
+	return strings.TrimPrefix(literal, `"`)
+}
+
+// nextRune decodes the character starting at byte offset i of s
+func nextRune(s string, i int) rune {
+	ch, _ := utf8.DecodeRuneInString(s[i:])
+	return ch
+}
+
+// matchingBrace returns the index of the '}' closing the '{' at open, or -1
+func matchingBrace(raw string, open int) int {
+	depth := 0
+	for i := open; i < len(raw); i++ {
+		switch raw[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '"':
+			for i++; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// escapeError describes a bad escape sequence at a byte offset in a string
+type escapeError struct {
+	offset  int
+	message string
+}
+
+// decodeEscapes decodes the escape sequences in the body of a string:
+// \" \\ \n \t \r \{ \} and \u{hex code point}
+func decodeEscapes(raw string) (string, *escapeError) {
+	if !strings.Contains(raw, "\\") {
+		return raw, nil
+	}
+
+	var out strings.Builder
+	var firstErr *escapeError
+	fail := func(offset int, format string, a ...interface{}) {
+		if firstErr == nil {
+			firstErr = &escapeError{offset: offset, message: fmt.Sprintf(format, a...)}
+		}
+	}
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			out.WriteByte(raw[i])
+			continue
+		}
+
+		start := i
+		i++
+		if i >= len(raw) {
+			fail(start, "unfinished escape sequence")
+			break
+		}
+
+		switch raw[i] {
+		case '"', '\\', '{', '}':
+			out.WriteByte(raw[i])
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case 'u':
+			if i+1 >= len(raw) || raw[i+1] != '{' {
+				fail(start, "expected { after \\u")
+				continue
+			}
+			end := strings.IndexByte(raw[i:], '}')
+			if end < 0 {
+				fail(start, "expected } to close \\u{")
+				i = len(raw)
+				continue
+			}
+			hex := raw[i+2 : i+end]
+			i += end
+			code, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				fail(start, "invalid unicode escape \\u{%s}", hex)
+				continue
+			}
+			out.WriteRune(rune(code))
+		default:
+			fail(start, "unknown escape sequence \\%c", raw[i])
+			out.WriteByte(raw[i])
+		}
+	}
 
-	return str
+	return out.String(), firstErr
 }
 
-func isLetter(ch byte) bool {
-	return unicode.IsLetter(rune(ch))
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte, line, column int) token.Token {
+func newToken(tokenType token.TokenType, ch rune, line, column int) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch), Line: line, Column: column}
 }
@@ -0,0 +1,165 @@
+package lexer
+
+import (
+	"az-lang/token"
+	"reflect"
+	"testing"
+)
+
+// tokenTypes lexes input and returns the type of every token before EOF
+func tokenTypes(t *testing.T, input string) []token.TokenType {
+	t.Helper()
+	l := New(input)
+	types := []token.TokenType{}
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		types = append(types, tok.Type)
+	}
+	if len(l.Errors()) > 0 {
+		t.Fatalf("unexpected lexer errors: %v", l.Errors())
+	}
+	return types
+}
+
+func TestKeywordsInCommentsAreSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"hash comment", `# say "x"`},
+		{"note comment", `note: stop the loop`},
+		{"capital note comment", `Note: reply with "x"`},
+		{"indented note comment", "    note: skip to next"},
+		{"block comment on one line", `### serve on 80 ###`},
+		{"block comment over lines", "###\nsay \"x\"\nserve on 80\n###"},
+		{"comments after each other", "# set x to 1\nnote: say x\n### raise \"x\" ###"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if types := tokenTypes(t, tt.input); len(types) != 0 {
+				t.Errorf("%q gave tokens %v, want none", tt.input, types)
+			}
+		})
+	}
+}
+
+func TestCommentsAroundCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []token.TokenType
+	}{
+		{
+			"comment after code",
+			`say 1    # say 2`,
+			[]token.TokenType{token.SAY, token.NUMBER},
+		},
+		{
+			"block comment between statements",
+			"say 1\n### say 2 ###\nsay 3",
+			[]token.TokenType{token.SAY, token.NUMBER, token.SAY, token.NUMBER},
+		},
+		{
+			"note comment between statements",
+			"say 1\nnote: say 2\nsay 3",
+			[]token.TokenType{token.SAY, token.NUMBER, token.SAY, token.NUMBER},
+		},
+		{
+			"hash inside a string",
+			`say "# not a comment"`,
+			[]token.TokenType{token.SAY, token.STRING},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenTypes(t, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q gave tokens %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoteIsANameAfterOtherText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []token.TokenType
+	}{
+		{
+			"check on a variable called note",
+			"check note:",
+			[]token.TokenType{token.CHECK, token.IDENT, token.COLON},
+		},
+		{
+			"set a variable called note",
+			`set note to "x"`,
+			[]token.TokenType{token.SET, token.IDENT, token.TO, token.STRING},
+		},
+		{
+			"note as the last word of a line",
+			"say note\nsay 1",
+			[]token.TokenType{token.SAY, token.IDENT, token.SAY, token.NUMBER},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenTypes(t, tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q gave tokens %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("say 1\n### never closed\nsay 2")
+	for l.NextToken().Type != token.EOF {
+	}
+	if len(l.Errors()) != 1 {
+		t.Fatalf("got errors %v, want one unterminated block comment error", l.Errors())
+	}
+}
+
+func TestTemplateExpressionPositions(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantLine   int
+		wantColumn int
+	}{
+		{"one line", `say "Hello {name} there"`, 1, 13},
+		{"after other characters", `say "é 👍🏽 {name}"`, 1, 12},
+		{"triple quotes", "say \"\"\"\nline one\nvalue {name}\n\"\"\"", 3, 8},
+		{"triple quotes with crlf", "say \"\"\"\r\nvalue {name}\r\n\"\"\"", 2, 8},
+		{"triple quotes on one line", `say """a {name}"""`, 1, 11},
+		{"later line of a string", "say \"\"\"a\n  b {name}\"\"\"", 2, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.input)
+			l.NextToken() // say
+			tok := l.NextToken()
+			if tok.Type != token.TEMPLATE {
+				t.Fatalf("got %s, want a TEMPLATE token", tok.Type)
+			}
+			parts, err := SplitTemplate(tok.Literal, tok.Column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, part := range parts {
+				if !part.IsCode {
+					continue
+				}
+				if line := tok.Line + part.Line; line != tt.wantLine || part.Column != tt.wantColumn {
+					t.Errorf("{%s} is at %d:%d, want %d:%d", part.Code, line, part.Column, tt.wantLine, tt.wantColumn)
+				}
+			}
+		})
+	}
+}
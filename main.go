@@ -35,7 +35,7 @@ func runFile(filename string) {
 		os.Exit(1)
 	}
 
-	env := object.NewEnvironment()
+	env := object.NewFileEnvironment(filename)
 	l := lexer.New(string(content))
 	p := parser.New(l)
 	program := p.ParseProgram()
@@ -48,19 +48,78 @@ func runFile(filename string) {
 	result := interpreter.Eval(program, env)
 	if result != nil {
 		if errObj, ok := result.(*object.Error); ok {
-			fmt.Println(errObj.Inspect())
+			printRuntimeError(filename, string(content), errObj)
 			os.Exit(1)
 		}
 	}
 }
 
+// printRuntimeError reports a runtime error with the offending source line,
+// a caret under the failing code and the function calls that led there:
+//
+//	ERROR: undefined variable: nme
+//	  --> greet.abc:2:24
+//	   |
+//	 2 |     say "Hello, " plus nme
+//	   |                        ^
+//	   = in greet, called at line 5
+//
+// An error inside a module shows the line from the module's file.
+func printRuntimeError(filename, source string, errObj *object.Error) {
+	fmt.Println(errObj.Inspect())
+
+	if errObj.File != "" && errObj.File != filename {
+		content, err := interpreter.ReadSource(errObj.File)
+		if err != nil {
+			return
+		}
+		filename, source = errObj.File, content
+	}
+
+	lines := strings.Split(source, "\n")
+	if errObj.Line < 1 || errObj.Line > len(lines) {
+		return
+	}
+
+	sourceLine := strings.TrimRight(lines[errObj.Line-1], "\r")
+	lineNumber := fmt.Sprintf("%d", errObj.Line)
+	gutter := strings.Repeat(" ", len(lineNumber))
+
+	fmt.Printf("%s--> %s:%d:%d\n", gutter, filename, errObj.Line, errObj.Column)
+	fmt.Printf("%s |\n", gutter)
+	fmt.Printf("%s | %s\n", lineNumber, sourceLine)
+
+	// Pad the caret with the same tabs as the source so it lines up
+	var caret strings.Builder
+	column := 1
+	for _, ch := range sourceLine {
+		if column >= errObj.Column {
+			break
+		}
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+		column++
+	}
+	caret.WriteRune('^')
+	fmt.Printf("%s | %s\n", gutter, caret.String())
+
+	for _, frame := range errObj.Stack {
+		fmt.Printf("%s = in %s, called at line %d\n", gutter, frame.Function, frame.Line)
+	}
+}
+
 func runREPL() {
 	fmt.Printf("ABC Language v%s\n", VERSION)
 	fmt.Println("An English-like programming language")
-	fmt.Println("Type your code below. Press Ctrl+C to exit.\n")
+	fmt.Println("Type your code below. Press Ctrl+C to exit.")
+	fmt.Println()
 
 	scanner := bufio.NewScanner(os.Stdin)
 	env := object.NewEnvironment()
+	globals := parser.NewScope()
 
 	for {
 		fmt.Print("abc> ")
@@ -79,7 +138,7 @@ func runREPL() {
 		}
 
 		l := lexer.New(line)
-		p := parser.New(l)
+		p := parser.NewWithScope(l, globals)
 		program := p.ParseProgram()
 
 		if len(p.Errors()) > 0 {
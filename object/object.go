@@ -5,25 +5,32 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	LIST_OBJ         = "LIST"
+	DICTIONARY_OBJ   = "DICTIONARY"
 	RESPONSE_OBJ     = "RESPONSE"
 	JSON_OBJ         = "JSON"
 	REQUEST_OBJ      = "REQUEST"
 	SERVER_OBJ       = "SERVER"
 	REPLY_VALUE_OBJ  = "REPLY_VALUE"
+	MODULE_OBJ       = "MODULE"
 )
 
 type Object interface {
@@ -39,6 +46,21 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+// Float represents a decimal value
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'f', -1, 64)
+	// Keep whole decimals recognisable: 2.0 rather than 2
+	if !strings.ContainsAny(str, ".IN") {
+		str += ".0"
+	}
+	return str
+}
+
 // String represents a string value
 type String struct {
 	Value string
@@ -69,19 +91,48 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
-// Error represents a runtime error
+// Break is the signal produced by "stop the loop"
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "stop the loop" }
+
+// Continue is the signal produced by "skip to next"
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "skip to next" }
+
+// Error represents a runtime error. Line and Column locate the node that
+// failed; Stack lists the function calls it passed through, innermost first.
 type Error struct {
 	Message string
+	Kind    string // broad category, such as "http" or "json"
+	File    string // the module the error happened in, or empty for the main script
+	Line    int
+	Column  int
+	Stack   []StackFrame
+}
+
+// StackFrame records a function call that a runtime error unwound through
+type StackFrame struct {
+	Function string
+	Line     int // line of the call site
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
-// Function represents a user-defined function
+// Function represents a user-defined function. Name is empty for
+// functions written as "a function with ...". Defaults holds the default
+// value of each parameter, or nil for required ones.
 type Function struct {
+	Name       string
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Line       int // where the function is defined
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -93,20 +144,27 @@ func (f *Function) Inspect() string {
 		params = append(params, p.String())
 	}
 
-	out.WriteString("to function")
+	if f.Name != "" {
+		out.WriteString("to " + f.Name)
+	} else {
+		out.WriteString("a function")
+	}
 	if len(params) > 0 {
 		out.WriteString(" with ")
 		out.WriteString(strings.Join(params, " and "))
 	}
-	out.WriteString(" z\n")
+	out.WriteString(" ")
 	out.WriteString(f.Body.String())
 
 	return out.String()
 }
 
-// List represents a list/array of values
+// List represents a list/array of values.
+// Lists can be shared between request handlers, so once a list is reachable
+// from a script its elements are read and written through the methods below.
 type List struct {
 	Elements []Object
+	mu       sync.RWMutex
 }
 
 func (l *List) Type() ObjectType { return LIST_OBJ }
@@ -114,7 +172,7 @@ func (l *List) Inspect() string {
 	var out bytes.Buffer
 
 	elements := []string{}
-	for _, e := range l.Elements {
+	for _, e := range l.Snapshot() {
 		elements = append(elements, e.Inspect())
 	}
 
@@ -125,6 +183,183 @@ func (l *List) Inspect() string {
 	return out.String()
 }
 
+// Snapshot returns a copy of the elements that is safe to iterate
+func (l *List) Snapshot() []Object {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	elements := make([]Object, len(l.Elements))
+	copy(elements, l.Elements)
+	return elements
+}
+
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.Elements)
+}
+
+// At returns the element at the zero-based index i. In this and the other
+// indexed methods a negative i counts back from the end, so -1 is the last
+// element; the bounds are checked under the same lock as the access.
+func (l *List) At(i int) (Object, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	i, ok := l.index(i)
+	if !ok {
+		return nil, false
+	}
+	return l.Elements[i], true
+}
+
+// SetAt replaces the element at index i
+func (l *List) SetAt(i int, val Object) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i, ok := l.index(i)
+	if !ok {
+		return false
+	}
+	l.Elements[i] = val
+	return true
+}
+
+// Insert places val before the element at index i, or at the end when i
+// is the length of the list
+func (l *List) Insert(i int, val Object) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if i < 0 || i > len(l.Elements) {
+		return false
+	}
+	l.Elements = append(l.Elements, nil)
+	copy(l.Elements[i+1:], l.Elements[i:])
+	l.Elements[i] = val
+	return true
+}
+
+// RemoveAt removes and returns the element at index i
+func (l *List) RemoveAt(i int) (Object, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i, ok := l.index(i)
+	if !ok {
+		return nil, false
+	}
+	val := l.Elements[i]
+	l.Elements = append(l.Elements[:i], l.Elements[i+1:]...)
+	return val, true
+}
+
+// RemoveFirst removes the first element that match accepts, and reports
+// whether there was one. match runs under the list's lock, so it must not
+// use this list.
+func (l *List) RemoveFirst(match func(Object) bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, elem := range l.Elements {
+		if match(elem) {
+			l.Elements = append(l.Elements[:i], l.Elements[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *List) Append(val Object) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Elements = append(l.Elements, val)
+}
+
+// index resolves a possibly negative index; the caller holds the lock
+func (l *List) index(i int) (int, bool) {
+	if i < 0 {
+		i += len(l.Elements)
+	}
+	return i, i >= 0 && i < len(l.Elements)
+}
+
+// Dictionary represents a mutable set of key/value pairs.
+// Keys are kept in insertion order so iteration and JSON output are stable.
+type Dictionary struct {
+	Keys  []string
+	Pairs map[string]Object
+	mu    sync.RWMutex
+}
+
+func NewDictionary() *Dictionary {
+	return &Dictionary{Keys: []string{}, Pairs: make(map[string]Object)}
+}
+
+func (d *Dictionary) Type() ObjectType { return DICTIONARY_OBJ }
+func (d *Dictionary) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	keys, values := d.Entries()
+	for i, key := range keys {
+		pairs = append(pairs, key+": "+values[i].Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (d *Dictionary) Get(key string) (Object, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	val, ok := d.Pairs[key]
+	return val, ok
+}
+
+func (d *Dictionary) Set(key string, val Object) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.Pairs[key]; !exists {
+		d.Keys = append(d.Keys, key)
+	}
+	d.Pairs[key] = val
+}
+
+// Delete removes key and reports whether it was present
+func (d *Dictionary) Delete(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.Pairs[key]; !exists {
+		return false
+	}
+	delete(d.Pairs, key)
+	for i, k := range d.Keys {
+		if k == key {
+			d.Keys = append(d.Keys[:i], d.Keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.Keys)
+}
+
+// Entries returns copies of the keys and their values, in insertion order
+func (d *Dictionary) Entries() ([]string, []Object) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	keys := make([]string, len(d.Keys))
+	copy(keys, d.Keys)
+	values := make([]Object, len(keys))
+	for i, key := range keys {
+		values[i] = d.Pairs[key]
+	}
+	return keys, values
+}
+
 // Response represents an HTTP response
 type Response struct {
 	StatusCode int
@@ -151,10 +386,37 @@ func (j *Json) Inspect() string {
 	return string(bytes)
 }
 
-// Environment holds variable bindings
+// Module is a script loaded with "use". Env holds its top-level
+// variables; only the names in Exports can be reached from outside.
+type Module struct {
+	Name    string
+	Path    string
+	Env     *Environment
+	Exports []string
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + m.Name }
+
+// Exported returns the current value of an exported name
+func (m *Module) Exported(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
+
+// Environment holds variable bindings.
+// Request handlers run concurrently against the same global environment,
+// so every access to the store is locked.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store   map[string]Object
+	outer   *Environment
+	mu      sync.RWMutex
+	file    string    // the script a top-level environment runs, if known
+	imports []*Module // modules used without a name, most recent last
 }
 
 func NewEnvironment() *Environment {
@@ -162,6 +424,20 @@ func NewEnvironment() *Environment {
 	return &Environment{store: s, outer: nil}
 }
 
+// NewFileEnvironment returns a top-level environment for running the
+// script at path. Modules it uses are found relative to it.
+func NewFileEnvironment(path string) *Environment {
+	env := NewEnvironment()
+	env.file = path
+	return env
+}
+
+// File returns the script that the outermost environment around e runs,
+// or "" when it is not known, as in the REPL
+func (e *Environment) File() string {
+	return e.Ancestor(-1).file
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
@@ -169,18 +445,73 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
 	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	imports := e.imports
+	e.mu.RUnlock()
+	if ok {
+		return obj, true
+	}
+	if e.outer != nil {
+		return e.outer.Get(name)
 	}
-	return obj, ok
+	for i := len(imports) - 1; i >= 0; i-- {
+		if obj, ok := imports[i].Exported(name); ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// Import makes the exports of m readable by name in e, always giving their
+// current values. Names that e defines itself come first, and a module
+// imported later comes before one imported earlier.
+func (e *Environment) Import(m *Module) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.imports = append(e.imports, m)
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.store[name] = val
 	return val
 }
 
+// Ancestor returns the environment depth scopes out from e, stopping at
+// the outermost one. A negative depth goes all the way out.
+func (e *Environment) Ancestor(depth int) *Environment {
+	env := e
+	for i := 0; (depth < 0 || i < depth) && env.outer != nil; i++ {
+		env = env.outer
+	}
+	return env
+}
+
+// Update replaces the value of name in the scope that defines it, holding
+// that scope's lock so concurrent updates are not lost. If update returns
+// an error the variable is left unchanged. It reports false if name is not
+// defined.
+func (e *Environment) Update(name string, update func(current Object) Object) (Object, bool) {
+	e.mu.Lock()
+	current, ok := e.store[name]
+	if !ok {
+		e.mu.Unlock()
+		if e.outer == nil {
+			return nil, false
+		}
+		return e.outer.Update(name, update)
+	}
+	defer e.mu.Unlock()
+
+	result := update(current)
+	if result.Type() != ERROR_OBJ {
+		e.store[name] = result
+	}
+	return result, true
+}
+
 // Request represents an incoming HTTP request
 type Request struct {
 	Method      string
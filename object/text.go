@@ -0,0 +1,62 @@
+package object
+
+import "unicode"
+
+const zeroWidthJoiner = '‍'
+
+// Graphemes splits s into user-perceived characters: a base character plus
+// any combining marks, emoji modifiers and joiners that belong to it, so
+// "é" written as e + U+0301, "👍🏽" and "🇬🇧" each count as one character.
+// This follows the main rules of Unicode extended grapheme clusters without
+// the full property tables.
+func Graphemes(s string) []string {
+	clusters := []string{}
+	start := 0
+	regional := 0 // regional indicator symbols in the current cluster
+	var prev rune
+
+	for i, r := range s {
+		if i > start && !extendsCluster(prev, r, regional) {
+			clusters = append(clusters, s[start:i])
+			start = i
+			regional = 0
+		}
+		if isRegionalIndicator(r) {
+			regional++
+		}
+		prev = r
+	}
+
+	if start < len(s) {
+		clusters = append(clusters, s[start:])
+	}
+	return clusters
+}
+
+// extendsCluster reports whether r belongs to the same character as prev
+func extendsCluster(prev, r rune, regional int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case prev == '\r' || prev == '\n':
+		return false
+	case prev == zeroWidthJoiner || r == zeroWidthJoiner:
+		return true
+	case unicode.IsMark(r):
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F: // variation selectors
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // emoji skin tone modifiers
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // emoji tag sequences
+		return true
+	case isRegionalIndicator(r):
+		// Flags are pairs of regional indicators
+		return isRegionalIndicator(prev) && regional%2 == 1
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
@@ -6,18 +6,31 @@ import (
 	"az-lang/token"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
-	l         *lexer.Lexer
-	curToken  token.Token
-	peekToken token.Token
-	errors    []string
+	l          *lexer.Lexer
+	curToken   token.Token
+	peekToken  token.Token
+	peek2Token token.Token
+	errors     []string
+	globals    *Scope
+	loopDepth  int  // loops around the statement being parsed, within the current function
+	blockDepth int  // blocks of any kind around the statement being parsed
+	withEnds   bool // "with" ends the operand being parsed instead of starting a call
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
-	// Read two tokens to initialize curToken and peekToken
+	return NewWithScope(l, NewScope())
+}
+
+// NewWithScope returns a parser that resolves assignments against an
+// existing top-level scope
+func NewWithScope(l *lexer.Lexer, globals *Scope) *Parser {
+	p := &Parser{l: l, errors: []string{}, globals: globals}
+	// Read three tokens to initialize curToken, peekToken and peek2Token
+	p.nextToken()
 	p.nextToken()
 	p.nextToken()
 	return p
@@ -29,13 +42,29 @@ func (p *Parser) Errors() []string {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.peek2Token
+	p.peek2Token = p.l.NextToken()
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
 	return p.curToken.Type == t
 }
 
+func (p *Parser) curTokenIsAny(types []token.TokenType) bool {
+	for _, t := range types {
+		if p.curTokenIs(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// peek2TokenIs looks two tokens ahead, for the few phrases where the next
+// word alone is ambiguous, such as "repeat 5 times do"
+func (p *Parser) peek2TokenIs(t token.TokenType) bool {
+	return p.peek2Token.Type == t
+}
+
 func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.peekToken.Type == t
 }
@@ -50,11 +79,27 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
+	if t == token.IDENT && p.peekIsReservedWord() {
+		p.reservedWordError()
+		return
+	}
 	msg := fmt.Sprintf("line %d: expected next token to be %s, got %s instead",
 		p.peekToken.Line, t, p.peekToken.Type)
 	p.errors = append(p.errors, msg)
 }
 
+// peekIsReservedWord reports whether the next token is a keyword written
+// where a name could go
+func (p *Parser) peekIsReservedWord() bool {
+	return p.peekToken.Type != token.IDENT && token.LookupIdent(p.peekToken.Literal) == p.peekToken.Type
+}
+
+func (p *Parser) reservedWordError() {
+	msg := fmt.Sprintf("line %d: %s is a reserved word and can't be used as a name",
+		p.peekToken.Line, p.peekToken.Literal)
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -67,6 +112,12 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	p.errors = append(p.errors, p.l.Errors()...)
+
+	if len(p.errors) == 0 {
+		resolve(program.Statements, p.globals)
+	}
+
 	return program
 }
 
@@ -88,12 +139,41 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseFunctionDefinition()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.LET:
+		return p.parseLetStatement()
+	case token.GLOBAL:
+		return p.parseGlobalStatement()
+	case token.CHECK:
+		return p.parseCheckStatement()
+	case token.TRY:
+		return p.parseTryStatement()
+	case token.RAISE:
+		return p.parseRaiseStatement()
+	case token.CALL, token.LPAREN:
+		return p.parseExpressionStatement()
+	case token.IDENT:
+		// Calls can stand on their own: greet with "Alice", or
+		// log's write with "started"
+		if p.peekTokenIs(token.WITH) || p.peekTokenIs(token.POSSESSIVE) {
+			return p.parseExpressionStatement()
+		}
+		return nil
+	case token.USE:
+		return p.parseUseStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	case token.SAY:
 		return p.parseSayStatement()
 	case token.ASK:
 		return p.parseAskStatement()
 	case token.APPEND:
 		return p.parseAppendStatement()
+	case token.REMOVE:
+		return p.parseRemoveStatement()
+	case token.INSERT:
+		return p.parseInsertStatement()
+	case token.POP:
+		return p.parsePopStatement()
 	case token.FETCH:
 		return p.parseFetchStatement()
 	case token.SEND:
@@ -115,28 +195,144 @@ func (p *Parser) parseStatement() ast.Statement {
 	case token.REPLY:
 		return p.parseReplyStatement()
 	case token.STOP:
+		if p.peekTokenIs(token.THE) {
+			return p.parseStopLoopStatement()
+		}
 		return p.parseStopServerStatement()
+	case token.SKIP:
+		return p.parseSkipStatement()
+	case token.REPEAT:
+		return p.parseRepeatStatement()
+	case token.ILLEGAL:
+		p.errors = append(p.errors, fmt.Sprintf("line %d: unexpected character %q",
+			p.curToken.Line, p.curToken.Literal))
+		return nil
 	default:
 		return nil
 	}
 }
 
-// parseSetStatement parses: set x to 5
-func (p *Parser) parseSetStatement() *ast.SetStatement {
-	stmt := &ast.SetStatement{Token: p.curToken}
+// parseSetStatement parses: set x to 5, set "key" of dict to 5 or
+// set item 2 of list to 5
+func (p *Parser) parseSetStatement() ast.Statement {
+	setToken := p.curToken
 
-	if !p.expectPeek(token.IDENT) {
+	if p.peekItemPosition() {
+		return p.parseSetItemStatement(setToken)
+	}
+
+	if p.peekIsReservedWord() && p.peek2TokenIs(token.TO) {
+		// Report the keyword, then read the rest as a normal assignment
+		p.reservedWordError()
+	} else if !p.peekTokenIs(token.IDENT) {
+		// Only keyed assignment can start with something other than a name
+		p.nextToken()
+		return p.parseSetKeyStatement(setToken, p.parsePrimary())
+	}
+
+	p.nextToken()
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.OF) {
+		return p.parseSetKeyStatement(setToken, name)
+	}
+
+	stmt := &ast.SetStatement{Token: setToken, Name: name}
+
+	if !p.expectPeek(token.TO) {
 		return nil
 	}
 
+	p.nextToken()
+
+	stmt.Value = p.parseExpression()
+
+	return stmt
+}
+
+// parseLetStatement parses: let x be 5
+func (p *Parser) parseLetStatement() *ast.LetStatement {
+	stmt := &ast.LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	if !p.expectPeek(token.BE) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression()
+
+	return stmt
+}
+
+// parseGlobalStatement parses: global x [and y ...]
+func (p *Parser) parseGlobalStatement() *ast.GlobalStatement {
+	stmt := &ast.GlobalStatement{Token: p.curToken}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.AND) {
+			break
+		}
+		p.nextToken() // consume AND
+	}
+
+	return stmt
+}
+
+// parseSetKeyStatement parses the rest of: set "key" of dict to value
+func (p *Parser) parseSetKeyStatement(setToken token.Token, key ast.Expression) ast.Statement {
+	stmt := &ast.SetKeyStatement{Token: setToken, Key: key}
+
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Target = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
 	if !p.expectPeek(token.TO) {
 		return nil
 	}
 
 	p.nextToken()
+	stmt.Value = p.parseExpression()
 
+	return stmt
+}
+
+// parseSetItemStatement parses: set item 2 of notes to "text"
+func (p *Parser) parseSetItemStatement(setToken token.Token) ast.Statement {
+	stmt := &ast.SetItemStatement{Token: setToken}
+
+	stmt.Position = p.parseItemPosition()
+	if stmt.Position == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Target = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	p.nextToken()
 	stmt.Value = p.parseExpression()
 
 	return stmt
@@ -187,7 +383,7 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	stmt := &ast.IfStatement{Token: p.curToken}
 
 	p.nextToken()
-	stmt.Condition = p.parseCondition()
+	stmt.Condition = p.parseExpression()
 
 	if !p.expectPeek(token.THEN) {
 		return nil
@@ -196,217 +392,1231 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	p.nextToken() // move past THEN
 	stmt.Consequence = p.parseBlockStatement()
 
-	if p.peekTokenIs(token.OTHERWISE) {
-		p.nextToken() // consume OTHERWISE
-		p.nextToken() // move to first statement of alternative
-		stmt.Alternative = p.parseBlockStatement()
+	switch {
+	case p.curTokenIs(token.OTHERWISE):
+		stmt.Alternative = p.parseOtherwise()
+	case p.peekTokenIs(token.OTHERWISE):
+		// if ... done otherwise ... done
+		p.nextToken()
+		stmt.Alternative = p.parseOtherwise()
 	}
 
 	return stmt
 }
 
-// parseCondition parses comparison and logical expressions
-func (p *Parser) parseCondition() ast.Expression {
-	return p.parseLogicalOr()
+// parseOtherwise parses the branch after OTHERWISE:
+// - otherwise ... done
+// - otherwise if ... then ... done, sharing the final done with the chain
+func (p *Parser) parseOtherwise() *ast.BlockStatement {
+	if p.peekTokenIs(token.IF) {
+		p.nextToken() // move to IF
+		block := &ast.BlockStatement{Token: p.curToken}
+		if nested := p.parseIfStatement(); nested != nil {
+			block.Statements = []ast.Statement{nested}
+		}
+		return block
+	}
+
+	p.nextToken() // move to first statement of alternative
+	return p.parseBlockStatement()
 }
 
-// parseLogicalOr handles: x or y
-func (p *Parser) parseLogicalOr() ast.Expression {
-	left := p.parseLogicalAnd()
+// parseCheckStatement parses:
+//
+//	check x:
+//	    when 1 then ...
+//	    when 2 or 3 then ...
+//	    when 4 to 9 then ...
+//	    otherwise ...
+//	done
+func (p *Parser) parseCheckStatement() *ast.CheckStatement {
+	stmt := &ast.CheckStatement{Token: p.curToken}
 
-	for p.peekTokenIs(token.OR) {
-		p.nextToken() // consume OR
-		opToken := p.curToken
+	p.nextToken()
+	stmt.Subject = p.parseExpression()
+
+	if p.peekTokenIs(token.COLON) {
 		p.nextToken()
-		right := p.parseLogicalAnd()
-		left = &ast.LogicalExpression{
-			Token:    opToken,
-			Left:     left,
-			Operator: "or",
-			Right:    right,
+	}
+
+	if !p.expectPeek(token.WHEN) {
+		return nil
+	}
+
+	for p.curTokenIs(token.WHEN) {
+		c := &ast.CheckCase{Token: p.curToken}
+
+		for {
+			p.nextToken()
+			match := ast.CheckMatch{Value: p.parseOperand()}
+			if p.peekTokenIs(token.TO) {
+				p.nextToken() // consume TO
+				p.nextToken()
+				match.To = p.parseOperand()
+			}
+			c.Matches = append(c.Matches, match)
+
+			if !p.peekTokenIs(token.OR) {
+				break
+			}
+			p.nextToken() // consume OR
 		}
+
+		if !p.expectPeek(token.THEN) {
+			return nil
+		}
+		p.nextToken() // move past THEN
+		c.Body = p.parseBlockUntil(token.WHEN)
+		stmt.Cases = append(stmt.Cases, c)
 	}
 
-	return left
+	if p.curTokenIs(token.OTHERWISE) {
+		p.nextToken() // move to first statement of otherwise
+		stmt.Otherwise = p.parseBlockStatement()
+	}
+
+	if !p.curTokenIs(token.DONE) {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'done' to close check", stmt.Token.Line))
+		return nil
+	}
+
+	return stmt
 }
 
-// parseLogicalAnd handles: x and y
-func (p *Parser) parseLogicalAnd() ast.Expression {
-	left := p.parseLogicalNot()
+// Operator precedence, from loosest to tightest binding. An operator only
+// takes a neighbouring operand away from operators with lower precedence,
+// so "x plus 1 is greater than y and z" reads as
+// "((x plus 1) is greater than y) and z".
+//
+//	LOWEST
+//	LOGICAL_OR   x or y
+//	LOGICAL_AND  x and y
+//	LOGICAL_NOT  not x
+//	COMPARISON   x equals y, x is greater than y, x contains y, x matches pattern p, ...
+//	LIST_OP      items where f, items transformed by f, items sorted, x repeated n times
+//	SUM          x plus y, x minus y
+//	PRODUCT      x times y, x divided by y
+//	CONVERSION   x as a number, x as text, ...
+//	PREFIX       minus x
+//
+// All binary operators are left-associative. Parentheses, or the English
+// "the result of", group an expression explicitly.
+const (
+	_ int = iota
+	LOWEST
+	LOGICAL_OR
+	LOGICAL_AND
+	LOGICAL_NOT
+	COMPARISON
+	LIST_OP
+	SUM
+	PRODUCT
+	CONVERSION
+	PREFIX
+)
 
-	for p.peekTokenIs(token.AND) {
-		p.nextToken() // consume AND
-		opToken := p.curToken
-		p.nextToken()
-		right := p.parseLogicalNot()
-		left = &ast.LogicalExpression{
-			Token:    opToken,
-			Left:     left,
-			Operator: "and",
-			Right:    right,
+var precedences = map[token.TokenType]int{
+	token.OR:          LOGICAL_OR,
+	token.AND:         LOGICAL_AND,
+	token.EQUALS:      COMPARISON,
+	token.IS:          COMPARISON,
+	token.DOES:        COMPARISON,
+	token.CONTAINS:    COMPARISON,
+	token.STARTS:      COMPARISON,
+	token.ENDS:        COMPARISON,
+	token.MATCHES:     COMPARISON,
+	token.WHERE:       LIST_OP,
+	token.TRANSFORMED: LIST_OP,
+	token.SORTED:      LIST_OP,
+	token.REPEATED:    LIST_OP,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.TIMES:       PRODUCT,
+	token.DIVIDED:     PRODUCT,
+	token.AS:          CONVERSION,
+}
+
+// peekPrecedence returns the precedence of the operator after the current
+// token, or LOWEST if it does not continue the expression
+func (p *Parser) peekPrecedence() int {
+	// "times do" ends the count of a repeat loop rather than multiplying
+	if p.peekTokenIs(token.TIMES) && p.peek2TokenIs(token.DO) {
+		return LOWEST
+	}
+	// "as" converts only in "as a number" and "as text"; "as json" and the
+	// "as" of a header or dictionary entry belong to the statement around
+	if p.peekTokenIs(token.AS) && !p.peek2TokenIs(token.A) && p.peek2Token.Literal != "text" {
+		return LOWEST
+	}
+	if prec, ok := precedences[p.peekToken.Type]; ok {
+		return prec
+	}
+	return LOWEST
+}
+
+// parseExpression parses a complete expression, conditions included
+func (p *Parser) parseExpression() ast.Expression {
+	return p.parseExpressionWith(LOWEST)
+}
+
+// parseOperand parses an expression that stops before "and", "or", the
+// comparisons and the list operations, for places where those words
+// separate or follow operands: list elements, call arguments, dictionary
+// values and comparison bounds
+func (p *Parser) parseOperand() ast.Expression {
+	return p.parseExpressionWith(LIST_OP)
+}
+
+// parseExpressionWith parses an expression made of operators that bind
+// more tightly than precedence
+func (p *Parser) parseExpressionWith(precedence int) ast.Expression {
+	left := p.parsePrimary()
+	if left == nil {
+		return nil
+	}
+
+	for precedence < p.peekPrecedence() {
+		p.nextToken() // move to operator
+		left = p.parseInfix(left)
+		if left == nil {
+			return nil
 		}
 	}
 
 	return left
 }
 
-// parseLogicalNot handles: not x
-func (p *Parser) parseLogicalNot() ast.Expression {
-	if p.curTokenIs(token.NOT) {
-		opToken := p.curToken
-		p.nextToken()
-		right := p.parseLogicalNot()
-		return &ast.LogicalExpression{
-			Token:    opToken,
-			Left:     nil,
-			Operator: "not",
-			Right:    right,
-		}
+// parseInfix parses the operator at the current token and its right-hand side
+func (p *Parser) parseInfix(left ast.Expression) ast.Expression {
+	switch p.curToken.Type {
+	case token.AND, token.OR:
+		return p.parseLogicalExpression(left)
+	case token.PLUS, token.MINUS, token.TIMES, token.DIVIDED:
+		return p.parseArithmeticExpression(left)
+	case token.WHERE, token.TRANSFORMED, token.SORTED:
+		return p.parseListOperation(left)
+	case token.REPEATED:
+		return p.parseRepeatedExpression(left)
+	case token.AS:
+		return p.parseConversionExpression(left)
+	}
+	return p.parseComparison(left)
+}
+
+// parseLogicalExpression handles: x and y, x or y
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	opToken := p.curToken
+	precedence := precedences[opToken.Type]
+
+	p.nextToken()
+	right := p.parseExpressionWith(precedence)
+	if right == nil {
+		return nil
 	}
 
-	return p.parseComparison()
+	return &ast.LogicalExpression{
+		Token:    opToken,
+		Left:     left,
+		Operator: opToken.Literal,
+		Right:    right,
+	}
 }
 
-// parseComparison handles: x equals y, x is greater than y, x is less than y
-func (p *Parser) parseComparison() ast.Expression {
-	left := p.parseArithmeticExpression()
+// parseNotExpression handles: not x
+func (p *Parser) parseNotExpression() ast.Expression {
+	opToken := p.curToken
 
-	// Check for comparison operators
-	if p.peekTokenIs(token.EQUALS) {
-		p.nextToken() // consume EQUALS
-		opToken := p.curToken
-		p.nextToken()
-		right := p.parseArithmeticExpression()
-		return &ast.ComparisonExpression{
-			Token:    opToken,
-			Left:     left,
-			Operator: "equals",
-			Right:    right,
-		}
+	p.nextToken()
+	right := p.parseExpressionWith(LOGICAL_NOT)
+	if right == nil {
+		return nil
 	}
 
-	if p.peekTokenIs(token.IS) {
-		p.nextToken() // consume IS
+	return &ast.LogicalExpression{
+		Token:    opToken,
+		Left:     nil,
+		Operator: "not",
+		Right:    right,
+	}
+}
 
-		if p.peekTokenIs(token.GREATER) {
-			p.nextToken() // consume GREATER
-			opToken := p.curToken
-			if !p.expectPeek(token.THAN) {
-				return nil
-			}
-			p.nextToken()
-			right := p.parseArithmeticExpression()
-			return &ast.ComparisonExpression{
-				Token:    opToken,
-				Left:     left,
-				Operator: "greater",
-				Right:    right,
-			}
+// parseComparison handles, with the current token at the first operator word:
+// - x equals y, x does not equal y, x is y, x is not y
+// - x is greater than y, x is less than y, x is at least y, x is at most y
+// - x is between y and z, x is empty, x is in y
+// - x contains y, x does not contain y, x starts with y, x ends with y
+// Every form that starts with "is" can be negated with "is not".
+func (p *Parser) parseComparison(left ast.Expression) ast.Expression {
+	opToken := p.curToken
+
+	switch opToken.Type {
+	case token.EQUALS:
+		return p.finishComparison(opToken, left, "equals", false)
+	case token.CONTAINS:
+		return p.finishComparison(opToken, left, "contains", false)
+	case token.MATCHES:
+		return p.parseMatchExpression(opToken, left, false)
+	case token.STARTS, token.ENDS:
+		op := "starts with"
+		if opToken.Type == token.ENDS {
+			op = "ends with"
 		}
-
-		if p.peekTokenIs(token.LESS) {
-			p.nextToken() // consume LESS
-			opToken := p.curToken
-			if !p.expectPeek(token.THAN) {
-				return nil
-			}
+		if !p.expectPeek(token.WITH) {
+			return nil
+		}
+		return p.finishComparison(opToken, left, op, false)
+	case token.DOES:
+		if !p.expectPeek(token.NOT) {
+			return nil
+		}
+		switch {
+		case p.peekTokenIs(token.EQUAL):
 			p.nextToken()
-			right := p.parseArithmeticExpression()
-			return &ast.ComparisonExpression{
-				Token:    opToken,
-				Left:     left,
-				Operator: "less",
-				Right:    right,
-			}
+			return p.finishComparison(opToken, left, "equals", true)
+		case p.peekTokenIs(token.CONTAIN):
+			p.nextToken()
+			return p.finishComparison(opToken, left, "contains", true)
+		case p.peekToken.Literal == "match":
+			p.nextToken()
+			return p.parseMatchExpression(opToken, left, true)
 		}
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'equal', 'contain' or 'match' after 'does not', got %s",
+			p.peekToken.Line, p.peekToken.Type))
+		return nil
 	}
 
-	return left
+	return p.parseIsComparison(left)
 }
 
-// parseArithmeticExpression handles: x plus y, x minus y, x times y, x divided by y
-func (p *Parser) parseArithmeticExpression() ast.Expression {
-	left := p.parseTerm()
+// parseIsComparison parses the rest of a comparison starting at IS
+func (p *Parser) parseIsComparison(left ast.Expression) ast.Expression {
+	opToken := p.curToken
+	negated := false
+	if p.peekTokenIs(token.NOT) {
+		p.nextToken()
+		negated = true
+	}
 
-	for p.peekTokenIs(token.PLUS) || p.peekTokenIs(token.MINUS) {
-		p.nextToken() // consume operator
-		opToken := p.curToken
-		op := opToken.Literal
+	switch {
+	case p.peekTokenIs(token.GREATER), p.peekTokenIs(token.LESS):
+		p.nextToken()
+		op := "greater"
+		if p.curTokenIs(token.LESS) {
+			op = "less"
+		}
+		if !p.expectPeek(token.THAN) {
+			return nil
+		}
+		return p.finishComparison(opToken, left, op, negated)
+	case p.peekTokenIs(token.AT):
+		p.nextToken()
+		switch {
+		case p.peekTokenIs(token.LEAST):
+			p.nextToken()
+			return p.finishComparison(opToken, left, "at least", negated)
+		case p.peekTokenIs(token.MOST):
+			p.nextToken()
+			return p.finishComparison(opToken, left, "at most", negated)
+		}
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'least' or 'most' after 'is at', got %s",
+			p.peekToken.Line, p.peekToken.Type))
+		return nil
+	case p.peekTokenIs(token.BETWEEN):
+		p.nextToken()
+		expr := &ast.ComparisonExpression{Token: opToken, Left: left, Operator: "between", Negated: negated}
+		p.nextToken()
+		expr.Right = p.parseOperand()
+		if !p.expectPeek(token.AND) {
+			return nil
+		}
+		p.nextToken()
+		expr.Upper = p.parseOperand()
+		return expr
+	case p.peekTokenIs(token.EMPTY):
 		p.nextToken()
-		right := p.parseTerm()
-		left = &ast.ArithmeticExpression{
-			Token:    opToken,
-			Left:     left,
-			Operator: op,
-			Right:    right,
+		return &ast.ComparisonExpression{Token: opToken, Left: left, Operator: "empty", Negated: negated}
+	case p.peekTokenIs(token.IN):
+		p.nextToken()
+		return p.finishComparison(opToken, left, "in", negated)
+	case p.peekToken.Literal == "text" || p.peekToken.Literal == "nothing":
+		p.nextToken()
+		return p.parseTypeCheck(opToken, left, negated)
+	case p.peekTokenIs(token.A):
+		p.nextToken()
+		if p.startsTypeCheck() {
+			return p.parseTypeCheck(opToken, left, negated)
 		}
+		// A literal such as "a list of 1 and 2", already at its first token
+		right := p.parseExpressionWith(COMPARISON)
+		return &ast.ComparisonExpression{Token: opToken, Left: left, Operator: "equals", Right: right, Negated: negated}
 	}
 
-	return left
+	// Plain "x is y" compares for equality
+	return p.finishComparison(opToken, left, "equals", negated)
 }
 
-// parseTerm handles: x times y, x divided by y
-func (p *Parser) parseTerm() ast.Expression {
-	left := p.parsePrimary()
+// finishComparison parses the right-hand side once the operator words have
+// been read
+func (p *Parser) finishComparison(opToken token.Token, left ast.Expression, op string, negated bool) ast.Expression {
+	p.nextToken()
+	right := p.parseExpressionWith(COMPARISON)
+	return &ast.ComparisonExpression{
+		Token:    opToken,
+		Left:     left,
+		Operator: op,
+		Right:    right,
+		Negated:  negated,
+	}
+}
 
-	for p.peekTokenIs(token.TIMES) || p.peekTokenIs(token.DIVIDED) {
-		p.nextToken() // consume operator
-		opToken := p.curToken
-		op := opToken.Literal
+// conversionTargets are the types a value can be converted to with "as"
+var conversionTargets = map[string]bool{
+	"number":  true,
+	"text":    true,
+	"boolean": true,
+	"list":    true,
+}
 
-		if op == "divided" {
-			// Expect "by" after "divided"
-			if !p.expectPeek(token.BY) {
-				return nil
-			}
-		}
+// parseConversionExpression parses: x as a number, x as text, x as a
+// boolean, x as a list
+func (p *Parser) parseConversionExpression(left ast.Expression) ast.Expression {
+	expr := &ast.ConversionExpression{Token: p.curToken, Value: left}
 
+	p.nextToken() // consume AS
+	if p.curTokenIs(token.A) {
 		p.nextToken()
-		right := p.parsePrimary()
-		left = &ast.ArithmeticExpression{
-			Token:    opToken,
-			Left:     left,
-			Operator: op,
-			Right:    right,
-		}
 	}
 
-	return left
+	if !conversionTargets[p.curToken.Literal] {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'a number', 'text', 'a boolean' or 'a list' after 'as', got %s",
+			p.curToken.Line, p.curToken.Type))
+		return nil
+	}
+	expr.Target = p.curToken.Literal
+	return expr
 }
 
-// parsePrimary handles primary expressions
-func (p *Parser) parsePrimary() ast.Expression {
-	// Handle negative numbers: minus 5
-	if p.curTokenIs(token.MINUS) {
-		negToken := p.curToken
+// typeNames are the types that "is a number", "is text" and the other
+// type checks test for, which are also the names "type of" gives
+var typeNames = map[string]bool{
+	"number":     true,
+	"text":       true,
+	"boolean":    true,
+	"list":       true,
+	"dictionary": true,
+	"function":   true,
+	"nothing":    true,
+}
+
+// parseTypeCheck parses the type after "is" or "is not", with the parser
+// on the A of "is a number" or the name of "is text"
+func (p *Parser) parseTypeCheck(opToken token.Token, left ast.Expression, negated bool) ast.Expression {
+	if p.curTokenIs(token.A) {
 		p.nextToken()
-		value := p.parsePrimary()
-		return &ast.NegativeExpression{Token: negToken, Value: value}
 	}
+	return &ast.TypeCheckExpression{Token: opToken, Value: left, TypeName: p.curToken.Literal, Negated: negated}
+}
 
-	// Handle quoted strings
-	if p.curTokenIs(token.STRING) {
-		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+// startsTypeCheck reports whether the current A begins a type check such
+// as "a list" rather than a literal such as "a list of 1 and 2"
+func (p *Parser) startsTypeCheck() bool {
+	switch {
+	case p.peekTokenIs(token.LIST):
+		return !p.peek2TokenIs(token.OF)
+	case p.peekTokenIs(token.DICTIONARY):
+		return !p.peek2TokenIs(token.WITH)
+	case p.peekTokenIs(token.FUNCTION):
+		return !p.peek2TokenIs(token.WITH) && !p.peek2TokenIs(token.THAT)
+	}
+	return typeNames[p.peekToken.Literal]
+}
+
+// parseTypeOfExpression parses: type of x
+func (p *Parser) parseTypeOfExpression() ast.Expression {
+	expr := &ast.TypeOfExpression{Token: p.curToken}
+
+	p.nextToken() // consume type, now at OF
+	p.nextToken() // consume OF
+
+	expr.Value = p.parsePrimary()
+	if expr.Value == nil {
+		return nil
 	}
+	return expr
+}
 
-	// Handle "a list of" list literals
-	if p.curTokenIs(token.A) && p.peekTokenIs(token.LIST) {
-		return p.parseListLiteral()
+// parseMatchExpression parses the pattern after "matches" or "does not match"
+func (p *Parser) parseMatchExpression(opToken token.Token, left ast.Expression, negated bool) ast.Expression {
+	p.nextToken()
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
 	}
+	return &ast.MatchExpression{Token: opToken, Text: left, Pattern: pattern, Negated: negated}
+}
 
-	// Handle "length of" expression
-	if p.curTokenIs(token.LENGTH) && p.peekTokenIs(token.OF) {
-		return p.parseLengthExpression()
+// parsePattern parses: pattern "[0-9]+"
+func (p *Parser) parsePattern() *ast.Pattern {
+	if p.curToken.Literal != "pattern" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'pattern', got %s",
+			p.curToken.Line, p.curToken.Type))
+		return nil
 	}
+	pattern := &ast.Pattern{Token: p.curToken}
 
-	// Handle "item N from list" expression
-	if p.curTokenIs(token.ITEM) {
-		return p.parseIndexExpression()
+	p.nextToken()
+	pattern.Source = p.parsePrimaryBeforeWith()
+	if pattern.Source == nil {
+		return nil
 	}
+	return pattern
+}
 
-	// Handle "body of" expression
-	if p.curTokenIs(token.BODY) && p.peekTokenIs(token.OF) {
-		return p.parseBodyOfExpression()
+// parseFindExpression parses: the first match of pattern "[0-9]+" in path,
+// all matches of ..., the captures of ... and all captures of ...
+func (p *Parser) parseFindExpression() ast.Expression {
+	expr := &ast.FindExpression{Token: p.curToken, All: p.curToken.Literal == "all"}
+
+	p.nextToken() // consume THE or "all"
+	if p.curToken.Literal == "first" {
+		p.nextToken() // consume first, now at "match"
+	}
+	expr.Captures = p.curToken.Literal == "captures"
+
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+	p.nextToken()
+	expr.Pattern = p.parsePattern()
+	if expr.Pattern == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Text = p.parsePrimary()
+	if expr.Text == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseListOperation handles the operations written after a list:
+// - items where is_even
+// - items transformed by double
+// - items sorted, items sorted by get_age, items sorted by field "age"
+// The function can be a name, an inline function or a group.
+func (p *Parser) parseListOperation(left ast.Expression) ast.Expression {
+	opToken := p.curToken
+
+	switch opToken.Type {
+	case token.WHERE:
+		// items where x is greater than 3: the name before a comparison
+		// stands for each item, as in "each x in items where ..."
+		if p.peekTokenIs(token.IDENT) && precedences[p.peek2Token.Type] == COMPARISON {
+			p.nextToken()
+			variable := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			condition := p.parseExpression()
+			if condition == nil {
+				return nil
+			}
+			return &ast.WhereExpression{Token: opToken, List: left, Condition: functionOf(opToken, variable, condition)}
+		}
+		p.nextToken()
+		condition := p.parsePrimary()
+		if condition == nil {
+			return nil
+		}
+		return &ast.WhereExpression{Token: opToken, List: left, Condition: condition}
+	case token.TRANSFORMED:
+		if !p.expectPeek(token.BY) {
+			return nil
+		}
+		p.nextToken()
+		fn := p.parsePrimary()
+		if fn == nil {
+			return nil
+		}
+		return &ast.TransformExpression{Token: opToken, List: left, Function: fn}
+	}
+
+	expr := &ast.SortExpression{Token: opToken, List: left}
+	if !p.peekTokenIs(token.BY) {
+		return expr
+	}
+	p.nextToken() // consume BY
+	p.nextToken()
+
+	if p.curTokenIs(token.FIELD) {
+		p.nextToken()
+		expr.Field = p.parsePrimary()
+		if expr.Field == nil {
+			return nil
+		}
+		return expr
+	}
+
+	expr.Key = p.parsePrimary()
+	if expr.Key == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseEachExpression parses: each x in items where x is greater than 3
+// or each x in items transformed by x times 2. The condition or
+// transformation becomes a function of x, and extends to the end of the
+// expression.
+func (p *Parser) parseEachExpression() ast.Expression {
+	eachToken := p.curToken
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	variable := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	list := p.parseOperand()
+	if list == nil {
+		return nil
+	}
+
+	switch {
+	case p.peekTokenIs(token.WHERE):
+		p.nextToken()
+		opToken := p.curToken
+		p.nextToken()
+		condition := p.parseExpression()
+		if condition == nil {
+			return nil
+		}
+		return &ast.WhereExpression{Token: opToken, List: list, Condition: functionOf(eachToken, variable, condition)}
+	case p.peekTokenIs(token.TRANSFORMED):
+		p.nextToken()
+		opToken := p.curToken
+		if !p.expectPeek(token.BY) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression()
+		if value == nil {
+			return nil
+		}
+		return &ast.TransformExpression{Token: opToken, List: list, Function: functionOf(eachToken, variable, value)}
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'where' or 'transformed by' after 'each %s in ...', got %s",
+		p.peekToken.Line, variable.Value, p.peekToken.Type))
+	return nil
+}
+
+// functionOf wraps an expression in a one-parameter function that returns it
+func functionOf(tok token.Token, param *ast.Identifier, body ast.Expression) *ast.FunctionLiteral {
+	ret := &ast.ReturnStatement{Token: tok, ReturnValue: body}
+	return &ast.FunctionLiteral{
+		Token:      tok,
+		Parameters: []*ast.Identifier{param},
+		Defaults:   []ast.Expression{nil},
+		Body:       &ast.BlockStatement{Token: tok, Statements: []ast.Statement{ret}},
+	}
+}
+
+// aggregates maps the words allowed in "the ... of items" to operators
+var aggregates = map[string]string{
+	"sum":     "sum",
+	"average": "average",
+	"max":     "max",
+	"maximum": "max",
+	"min":     "min",
+	"minimum": "min",
+}
+
+// parseAggregateExpression parses: the sum of items, the average of items,
+// the max of items, the min of items
+func (p *Parser) parseAggregateExpression() ast.Expression {
+	p.nextToken() // consume THE, now at the operator word
+	expr := &ast.AggregateExpression{Token: p.curToken, Operator: aggregates[p.curToken.Literal]}
+
+	p.nextToken() // consume operator, now at OF
+	p.nextToken() // consume OF
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseReduceExpression parses: total of items using add
+// or total of items using add starting from 0
+func (p *Parser) parseReduceExpression() ast.Expression {
+	expr := &ast.ReduceExpression{Token: p.curToken}
+
+	p.nextToken() // consume total, now at OF
+	p.nextToken() // consume OF
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.USING) {
+		return nil
+	}
+	p.nextToken()
+	expr.Function = p.parsePrimary()
+	if expr.Function == nil {
+		return nil
+	}
+
+	if p.peekToken.Literal == "starting" && p.peek2TokenIs(token.FROM) {
+		p.nextToken() // consume starting
+		p.nextToken() // consume FROM
+		p.nextToken()
+		expr.Initial = p.parseOperand()
+		if expr.Initial == nil {
+			return nil
+		}
+	}
+
+	return expr
+}
+
+// parseReverseExpression parses: reverse of items
+func (p *Parser) parseReverseExpression() ast.Expression {
+	expr := &ast.ReverseExpression{Token: p.curToken}
+
+	p.nextToken() // consume reverse, now at OF
+	p.nextToken() // consume OF
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseUniqueExpression parses: unique items in tags
+func (p *Parser) parseUniqueExpression() ast.Expression {
+	expr := &ast.UniqueExpression{Token: p.curToken}
+
+	p.nextToken() // consume unique, now at items
+	p.nextToken() // consume items, now at IN
+	p.nextToken() // consume IN
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// startsTake reports whether the current "first" or "last" begins
+// "first 5 items of list" rather than naming a variable
+func (p *Parser) startsTake() bool {
+	if p.peekToken.Line != p.curToken.Line {
+		return false
+	}
+	switch {
+	case p.peekTokenIs(token.NUMBER), p.peekTokenIs(token.LPAREN), token.IsNumberWord(p.peekToken.Type):
+		return true
+	case p.peekTokenIs(token.IDENT):
+		return p.peek2Token.Literal == "items" || p.peek2TokenIs(token.ITEM)
+	}
+	return false
+}
+
+// parseTakeExpression parses: first 5 items of list, last 2 items of list
+func (p *Parser) parseTakeExpression() ast.Expression {
+	expr := &ast.TakeExpression{Token: p.curToken, FromEnd: p.curToken.Literal == "last"}
+
+	p.nextToken() // consume first or last
+	expr.Count = p.parsePrimary()
+	if expr.Count == nil {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curToken.Literal != "items" && !p.curTokenIs(token.ITEM) {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'items' after '%s %s', got %s",
+			p.curToken.Line, expr.Token.Literal, expr.Count.String(), p.curToken.Type))
+		return nil
+	}
+
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+	p.nextToken()
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// peekStartsOperand reports whether the next token, on the same line, can
+// begin an operand. A variable is never followed by one, so this tells
+// "trim input" from a variable named trim.
+func (p *Parser) peekStartsOperand() bool {
+	if p.peekToken.Line != p.curToken.Line {
+		return false
+	}
+	switch p.peekToken.Type {
+	case token.STRING, token.TEMPLATE, token.IDENT, token.NUMBER, token.LPAREN,
+		token.THE, token.A, token.EACH, token.CALL, token.ITEM, token.LENGTH,
+		token.FIELD, token.BODY, token.QUERY, token.HEADER:
+		return true
+	}
+	return token.IsNumberWord(p.peekToken.Type)
+}
+
+// parsePrimaryBeforeWith parses an operand that a "with" may follow, as in
+// "join names with", so that a name before the "with" is not read as a
+// call. A call can still be written in parentheses.
+func (p *Parser) parsePrimaryBeforeWith() ast.Expression {
+	withEnds := p.withEnds
+	p.withEnds = true
+	defer func() { p.withEnds = withEnds }()
+	return p.parsePrimary()
+}
+
+// parseExpressionBeforeWith parses an expression that a "with" may follow,
+// as in "fetch from url with headers", so the URL is not read as a call
+func (p *Parser) parseExpressionBeforeWith() ast.Expression {
+	withEnds := p.withEnds
+	p.withEnds = true
+	defer func() { p.withEnds = withEnds }()
+	return p.parseExpression()
+}
+
+// parseTextOperation parses the text operations that start with a verb:
+// split, join, trim, replace and pad
+func (p *Parser) parseTextOperation() ast.Expression {
+	switch p.curToken.Literal {
+	case "split":
+		return p.parseSplitExpression()
+	case "join":
+		return p.parseJoinExpression()
+	case "trim":
+		return p.parseTrimExpression()
+	case "replace":
+		return p.parseReplaceExpression()
+	}
+	return p.parsePadExpression()
+}
+
+// parseSplitExpression parses: split line by ","
+func (p *Parser) parseSplitExpression() ast.Expression {
+	expr := &ast.SplitExpression{Token: p.curToken}
+
+	p.nextToken() // consume split
+	expr.Text = p.parseOperand()
+	if expr.Text == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.BY) {
+		return nil
+	}
+	p.nextToken()
+	expr.Separator = p.parsePrimary()
+	if expr.Separator == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseJoinExpression parses: join names with ", ", or join letters
+func (p *Parser) parseJoinExpression() ast.Expression {
+	expr := &ast.JoinExpression{Token: p.curToken}
+
+	p.nextToken() // consume join
+	expr.List = p.parsePrimaryBeforeWith()
+	if expr.List == nil {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.WITH) {
+		return expr
+	}
+	p.nextToken() // consume WITH
+	p.nextToken()
+	expr.Separator = p.parsePrimary()
+	if expr.Separator == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseLetterCaseExpression parses: uppercase of name, lowercase of name
+func (p *Parser) parseLetterCaseExpression() ast.Expression {
+	expr := &ast.LetterCaseExpression{Token: p.curToken, Upper: p.curToken.Literal == "uppercase"}
+
+	p.nextToken() // consume uppercase or lowercase, now at OF
+	p.nextToken() // consume OF
+
+	expr.Text = p.parsePrimary()
+	if expr.Text == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseTrimExpression parses: trim input
+func (p *Parser) parseTrimExpression() ast.Expression {
+	expr := &ast.TrimExpression{Token: p.curToken}
+
+	p.nextToken() // consume trim
+	expr.Text = p.parsePrimary()
+	if expr.Text == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseReplaceExpression parses: replace "-" with " " in title, or
+// replace pattern "[0-9]+" with "#" in title
+func (p *Parser) parseReplaceExpression() ast.Expression {
+	expr := &ast.ReplaceExpression{Token: p.curToken}
+
+	p.nextToken() // consume replace
+	if p.curToken.Literal == "pattern" && !p.peekTokenIs(token.WITH) {
+		expr.Pattern = p.parsePattern()
+		if expr.Pattern == nil {
+			return nil
+		}
+	} else {
+		expr.Old = p.parsePrimaryBeforeWith()
+		if expr.Old == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.WITH) {
+		return nil
+	}
+	p.nextToken()
+	expr.New = p.parseOperand()
+	if expr.New == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Text = p.parsePrimary()
+	if expr.Text == nil {
+		return nil
+	}
+	return expr
+}
+
+// parsePositionExpression parses: position of "@" in email
+func (p *Parser) parsePositionExpression() ast.Expression {
+	expr := &ast.PositionExpression{Token: p.curToken}
+
+	p.nextToken() // consume position, now at OF
+	p.nextToken() // consume OF
+	expr.Target = p.parseOperand()
+	if expr.Target == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expr.Source = p.parsePrimary()
+	if expr.Source == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseCharactersExpression parses: characters 2 to 5 of name
+func (p *Parser) parseCharactersExpression() ast.Expression {
+	expr := &ast.CharactersExpression{Token: p.curToken}
+
+	p.nextToken() // consume characters
+	expr.From = p.parseOperand()
+	if expr.From == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	p.nextToken()
+	expr.To = p.parseOperand()
+	if expr.To == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.OF) {
+		return nil
+	}
+	p.nextToken()
+	expr.Text = p.parsePrimary()
+	if expr.Text == nil {
+		return nil
+	}
+	return expr
+}
+
+// parseRepeatedExpression parses: "-" repeated 20 times
+// The count ends before "times", so a sum needs parentheses:
+// "-" repeated (width plus 2) times.
+func (p *Parser) parseRepeatedExpression(left ast.Expression) ast.Expression {
+	expr := &ast.RepeatedExpression{Token: p.curToken, Text: left}
+
+	p.nextToken() // consume repeated
+	expr.Count = p.parseExpressionWith(PRODUCT)
+	if expr.Count == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.TIMES) {
+		return nil
+	}
+	return expr
+}
+
+// parsePadExpression parses: pad name to 10, with an optional fill and
+// side: pad code to 6 with "0" on the left
+func (p *Parser) parsePadExpression() ast.Expression {
+	expr := &ast.PadExpression{Token: p.curToken}
+
+	p.nextToken() // consume pad
+	expr.Text = p.parseOperand()
+	if expr.Text == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	p.nextToken()
+	expr.Width = p.parsePrimaryBeforeWith()
+	if expr.Width == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.WITH) {
+		p.nextToken() // consume WITH
+		p.nextToken()
+		expr.Fill = p.parsePrimary()
+		if expr.Fill == nil {
+			return nil
+		}
+	}
+
+	if p.peekTokenIs(token.ON) {
+		p.nextToken() // consume ON
+		if !p.expectPeek(token.THE) {
+			return nil
+		}
+		p.nextToken()
+		switch p.curToken.Literal {
+		case "left":
+			expr.Left = true
+		case "right":
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'left' or 'right' after 'on the', got %s",
+				p.curToken.Line, p.curToken.Type))
+			return nil
+		}
+	}
+	return expr
+}
+
+// parseArithmeticExpression handles: x plus y, x minus y, x times y, x divided by y
+func (p *Parser) parseArithmeticExpression(left ast.Expression) ast.Expression {
+	opToken := p.curToken
+	precedence := precedences[opToken.Type]
+
+	if opToken.Type == token.DIVIDED {
+		// Expect "by" after "divided"
+		if !p.expectPeek(token.BY) {
+			return nil
+		}
+	}
+
+	p.nextToken()
+	right := p.parseExpressionWith(precedence)
+	if right == nil {
+		return nil
+	}
+
+	return &ast.ArithmeticExpression{
+		Token:    opToken,
+		Left:     left,
+		Operator: opToken.Literal,
+		Right:    right,
+	}
+}
+
+// parsePrimary handles primary expressions: literals, names, calls, the
+// English accessors such as "length of", prefix operators and groups
+func (p *Parser) parsePrimary() ast.Expression {
+	// Handle negative numbers: minus 5
+	if p.curTokenIs(token.MINUS) {
+		negToken := p.curToken
+		p.nextToken()
+		value := p.parseExpressionWith(PREFIX)
+		if value == nil {
+			return nil
+		}
+		return &ast.NegativeExpression{Token: negToken, Value: value}
+	}
+
+	// Handle "not x"
+	if p.curTokenIs(token.NOT) {
+		return p.parseNotExpression()
+	}
+
+	// Handle parenthesised groups: (x plus 1)
+	if p.curTokenIs(token.LPAREN) {
+		return p.parseGroupedExpression()
+	}
+
+	// Handle "the result of" groups
+	if p.curTokenIs(token.THE) && p.peekToken.Literal == "result" && p.peek2TokenIs(token.OF) {
+		return p.parseResultOfExpression()
+	}
+
+	// Handle quoted strings
+	if p.curTokenIs(token.STRING) {
+		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	// Handle strings with {expressions} inside
+	if p.curTokenIs(token.TEMPLATE) {
+		return p.parseInterpolatedString()
+	}
+
+	// Handle "a list of" list literals
+	if p.curTokenIs(token.A) && p.peekTokenIs(token.LIST) {
+		return p.parseListLiteral()
+	}
+
+	// Handle "each x in items where ..." and "each x in items transformed by ..."
+	if p.curTokenIs(token.EACH) {
+		return p.parseEachExpression()
+	}
+
+	// Handle "the sum of", "the average of", "the max of", "the min of"
+	if p.curTokenIs(token.THE) && aggregates[p.peekToken.Literal] != "" && p.peek2TokenIs(token.OF) {
+		return p.parseAggregateExpression()
+	}
+
+	// Handle "the first match of pattern" and "the captures of pattern"
+	if p.curTokenIs(token.THE) && ((p.peekToken.Literal == "first" && p.peek2Token.Literal == "match") ||
+		(p.peekToken.Literal == "captures" && p.peek2TokenIs(token.OF))) {
+		return p.parseFindExpression()
+	}
+
+	// Handle "the total of ... using"
+	if p.curTokenIs(token.THE) && p.peekToken.Literal == "total" && p.peek2TokenIs(token.OF) {
+		p.nextToken() // consume THE
+		return p.parseReduceExpression()
+	}
+
+	// Handle list operations that start with an ordinary word. The words
+	// stay usable as variable names, since a name is never followed by
+	// what comes next here.
+	if p.curTokenIs(token.IDENT) {
+		switch {
+		case p.curToken.Literal == "total" && p.peekTokenIs(token.OF):
+			return p.parseReduceExpression()
+		case p.curToken.Literal == "reverse" && p.peekTokenIs(token.OF):
+			return p.parseReverseExpression()
+		case p.curToken.Literal == "unique" && p.peekToken.Literal == "items" && p.peek2TokenIs(token.IN):
+			return p.parseUniqueExpression()
+		case (p.curToken.Literal == "first" || p.curToken.Literal == "last") && p.startsTake():
+			return p.parseTakeExpression()
+		case (p.curToken.Literal == "first" || p.curToken.Literal == "last") && p.peekTokenIs(token.ITEM) && p.peek2TokenIs(token.FROM):
+			return p.parseFirstOrLastItem()
+		case p.curToken.Literal == "items" && p.startsSlice():
+			return p.parseSliceExpression()
+		}
+	}
+
+	// Handle text operations that start with an ordinary word, which stay
+	// usable as variable names in the same way
+	if p.curTokenIs(token.IDENT) {
+		switch p.curToken.Literal {
+		case "type":
+			if p.peekTokenIs(token.OF) {
+				return p.parseTypeOfExpression()
+			}
+		case "uppercase", "lowercase":
+			if p.peekTokenIs(token.OF) {
+				return p.parseLetterCaseExpression()
+			}
+		case "position":
+			if p.peekTokenIs(token.OF) {
+				return p.parsePositionExpression()
+			}
+		case "characters":
+			if p.startsSlice() {
+				return p.parseCharactersExpression()
+			}
+		case "all":
+			if (p.peekTokenIs(token.MATCHES) || p.peekToken.Literal == "captures") && p.peek2TokenIs(token.OF) {
+				return p.parseFindExpression()
+			}
+		case "split", "join", "trim", "replace", "pad":
+			if p.peekStartsOperand() {
+				return p.parseTextOperation()
+			}
+		}
+	}
+
+	// Handle "call greet" calls
+	if p.curTokenIs(token.CALL) {
+		return p.parseCallKeywordExpression()
+	}
+
+	// Handle "a function with" function literals
+	if p.curTokenIs(token.A) && p.peekTokenIs(token.FUNCTION) {
+		return p.parseFunctionLiteral()
+	}
+
+	// Handle "a dictionary with" dictionary literals
+	if p.curTokenIs(token.A) && p.peekTokenIs(token.DICTIONARY) {
+		return p.parseDictionaryLiteral()
+	}
+
+	// Handle "keys of" expression
+	if p.curTokenIs(token.KEYS) && p.peekTokenIs(token.OF) {
+		return p.parseKeysOfExpression()
+	}
+
+	// Handle "values of" expression
+	if p.curTokenIs(token.VALUES) && p.peekTokenIs(token.OF) {
+		return p.parseValuesOfExpression()
+	}
+
+	// Handle "length of" expression
+	if p.curTokenIs(token.LENGTH) && p.peekTokenIs(token.OF) {
+		return p.parseLengthExpression()
+	}
+
+	// Handle "item N from list" expression
+	if p.curTokenIs(token.ITEM) {
+		return p.parseIndexExpression()
+	}
+
+	// Handle "body of" expression
+	if p.curTokenIs(token.BODY) && p.peekTokenIs(token.OF) {
+		return p.parseBodyOfExpression()
 	}
 
 	// Handle "status of" expression
@@ -419,76 +1629,263 @@ func (p *Parser) parsePrimary() ast.Expression {
 		return p.parseHeaderFromExpression()
 	}
 
-	// Handle "field X from" expression
-	if p.curTokenIs(token.FIELD) {
-		return p.parseFieldFromExpression()
+	// Handle "field X from" expression
+	if p.curTokenIs(token.FIELD) {
+		return p.parseFieldFromExpression()
+	}
+
+	// Handle "method of" expression
+	if p.curTokenIs(token.METHOD) && p.peekTokenIs(token.OF) {
+		return p.parseMethodOfExpression()
+	}
+
+	// Handle "path of" expression
+	if p.curTokenIs(token.PATH) && p.peekTokenIs(token.OF) {
+		return p.parsePathOfExpression()
+	}
+
+	// Handle "query X from" expression
+	if p.curTokenIs(token.QUERY) {
+		return p.parseQueryFromExpression()
+	}
+
+	// Handle number words
+	if token.IsNumberWord(p.curToken.Type) {
+		return p.parseNumberWord()
+	}
+
+	// Handle numeric literals
+	if p.curTokenIs(token.NUMBER) {
+		if strings.Contains(p.curToken.Literal, ".") {
+			value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+			if err != nil {
+				p.errors = append(p.errors, fmt.Sprintf("could not parse %q as decimal", p.curToken.Literal))
+				return nil
+			}
+			return &ast.FloatLiteral{Token: p.curToken, Value: value}
+		}
+		value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+		if err != nil {
+			p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.curToken.Literal))
+			return nil
+		}
+		return &ast.IntegerLiteral{Token: p.curToken, Value: value}
+	}
+
+	// Handle identifiers (including function calls)
+	if p.curTokenIs(token.IDENT) {
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.POSSESSIVE) {
+			return p.parseMemberExpression(ident)
+		}
+
+		// Check if this is a function call: funcname with args
+		if p.peekTokenIs(token.WITH) && !p.withEnds {
+			return p.parseCallExpression(ident)
+		}
+
+		return ident
+	}
+
+	p.errors = append(p.errors, fmt.Sprintf("line %d: expected an expression, got %s",
+		p.curToken.Line, p.curToken.Type))
+	return nil
+}
+
+// parseGroupedExpression parses: (expression), or (expression) with args
+// to call the function the expression produces. "with status" and
+// "with header" after a group belong to the surrounding reply or request.
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	expr := p.parseGroup()
+	if expr == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.WITH) && !p.withEnds && !p.peek2TokenIs(token.STATUS) &&
+		!p.peek2TokenIs(token.HEADER) && !p.peek2TokenIs(token.HEADERS) {
+		return p.parseCallArguments(p.peekToken, expr, p.parseOperand)
+	}
+
+	return expr
+}
+
+// parseGroup parses the expression between ( and )
+func (p *Parser) parseGroup() ast.Expression {
+	withEnds := p.withEnds
+	p.withEnds = false
+	defer func() { p.withEnds = withEnds }()
+
+	p.nextToken() // consume (
+	expr := p.parseExpression()
+	if expr == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
 	}
 
-	// Handle "method of" expression
-	if p.curTokenIs(token.METHOD) && p.peekTokenIs(token.OF) {
-		return p.parseMethodOfExpression()
+	return expr
+}
+
+// parseCallKeywordExpression parses: call greet, call greet with "Bob",
+// or call (item 1 from handlers) with request. Unlike a bare name, "call"
+// runs a function even when it takes no arguments.
+func (p *Parser) parseCallKeywordExpression() ast.Expression {
+	callToken := p.curToken
+
+	var fn ast.Expression
+	switch {
+	case p.peekTokenIs(token.IDENT):
+		p.nextToken()
+		fn = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.POSSESSIVE) {
+			fn = p.parseMembers(fn)
+			if fn == nil {
+				return nil
+			}
+		}
+	case p.peekTokenIs(token.LPAREN):
+		p.nextToken()
+		fn = p.parseGroup()
+		if fn == nil {
+			return nil
+		}
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected a function after 'call', got %s",
+			p.peekToken.Line, p.peekToken.Type))
+		return nil
 	}
 
-	// Handle "path of" expression
-	if p.curTokenIs(token.PATH) && p.peekTokenIs(token.OF) {
-		return p.parsePathOfExpression()
+	if p.peekTokenIs(token.WITH) {
+		return p.parseCallArguments(callToken, fn, p.parseOperand)
 	}
 
-	// Handle "query X from" expression
-	if p.curTokenIs(token.QUERY) {
-		return p.parseQueryFromExpression()
+	return &ast.CallExpression{Token: callToken, Function: fn, Arguments: []ast.Expression{}}
+}
+
+// parseResultOfExpression parses: the result of (expression) or
+// the result of double with x. A call read this way takes single-word
+// arguments, so "the result of double with x plus 1" adds 1 to the result
+// instead of passing x plus 1.
+func (p *Parser) parseResultOfExpression() ast.Expression {
+	p.nextToken() // consume THE, now at result
+	p.nextToken() // consume result, now at OF
+	p.nextToken() // consume OF
+
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.WITH) {
+		fn := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return p.parseCallArguments(fn.Token, fn, p.parsePrimary)
 	}
 
-	// Handle number words
-	if token.IsNumberWord(p.curToken.Type) {
-		return p.parseNumberWord()
+	return p.parsePrimary()
+}
+
+// parseInterpolatedString parses "Hello, {name}!" into its text and
+// expression parts. Each expression is parsed now, with its own parser
+// positioned where the expression is, so errors point into the string.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+
+	parts, err := lexer.SplitTemplate(p.curToken.Literal, p.curToken.Column)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: %s", p.curToken.Line, err))
+		return nil
 	}
 
-	// Handle numeric literals
-	if p.curTokenIs(token.NUMBER) {
-		value, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
-		if err != nil {
-			p.errors = append(p.errors, fmt.Sprintf("could not parse %q as integer", p.curToken.Literal))
+	for _, part := range parts {
+		if !part.IsCode {
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: p.curToken, Value: part.Text})
+			continue
+		}
+
+		line := p.curToken.Line + part.Line
+		sub := New(lexer.NewAt(part.Code, line, part.Column-1))
+		expr := sub.parseExpression()
+		if !sub.peekTokenIs(token.EOF) {
+			sub.errors = append(sub.errors, fmt.Sprintf("line %d: unexpected %s in {%s}",
+				line, sub.peekToken.Type, part.Code))
+		}
+		p.errors = append(p.errors, sub.Errors()...)
+		p.errors = append(p.errors, sub.l.Errors()...)
+		if expr == nil {
+			p.errors = append(p.errors, fmt.Sprintf("line %d: could not read expression {%s}", line, part.Code))
 			return nil
 		}
-		return &ast.IntegerLiteral{Token: p.curToken, Value: value}
+
+		str.Parts = append(str.Parts, expr)
 	}
 
-	// Handle identifiers (including function calls)
-	if p.curTokenIs(token.IDENT) {
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return str
+}
 
-		// Check if this is a function call: funcname with args
-		if p.peekTokenIs(token.WITH) {
-			return p.parseCallExpression(ident)
-		}
+// parseMemberExpression parses: auth's check_token, or auth's check_token
+// with req to call it
+func (p *Parser) parseMemberExpression(module *ast.Identifier) ast.Expression {
+	expr := p.parseMembers(module)
+	if expr == nil {
+		return nil
+	}
 
-		return ident
+	if p.peekTokenIs(token.WITH) && !p.withEnds {
+		return p.parseCallArguments(module.Token, expr, p.parseOperand)
 	}
+	return expr
+}
 
-	return nil
+// parseMembers parses each 's after module: auth's tokens's check
+func (p *Parser) parseMembers(module ast.Expression) ast.Expression {
+	expr := module
+	for p.peekTokenIs(token.POSSESSIVE) {
+		p.nextToken() // consume the name before 's
+		member := &ast.MemberExpression{Token: p.curToken, Module: expr}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		member.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		expr = member
+	}
+	return expr
 }
 
 // parseCallExpression parses: funcname with arg1 and arg2
 func (p *Parser) parseCallExpression(fn *ast.Identifier) *ast.CallExpression {
-	call := &ast.CallExpression{Token: fn.Token, Function: fn}
+	return p.parseCallArguments(fn.Token, fn, p.parseOperand)
+}
+
+// parseCallArguments parses the arguments after WITH, reading each one
+// with parseArg. Arguments written "name as value" are passed by name and
+// must come after the others.
+func (p *Parser) parseCallArguments(tok token.Token, fn ast.Expression, parseArg func() ast.Expression) *ast.CallExpression {
+	call := &ast.CallExpression{Token: tok, Function: fn}
 	call.Arguments = []ast.Expression{}
 
 	p.nextToken() // consume WITH
-	p.nextToken() // move to first argument
-
-	arg := p.parsePrimary()
-	call.Arguments = append(call.Arguments, arg)
 
 	// Handle multiple arguments with "and"
-	for p.peekTokenIs(token.AND) {
-		p.nextToken() // consume AND
+	for {
 		p.nextToken() // move to argument
-		arg := p.parsePrimary()
-		call.Arguments = append(call.Arguments, arg)
-	}
 
-	return call
+		// "as json" after a value belongs to reply or parse, not to the call
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.AS) && !p.peek2TokenIs(token.JSON) {
+			name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			p.nextToken() // consume name
+			p.nextToken() // consume AS
+			call.Named = append(call.Named, ast.NamedArgument{Name: name, Value: parseArg()})
+		} else {
+			if len(call.Named) > 0 {
+				p.errors = append(p.errors, fmt.Sprintf("line %d: arguments passed by position must come before named ones",
+					p.curToken.Line))
+				return nil
+			}
+			call.Arguments = append(call.Arguments, parseArg())
+		}
+
+		if !p.peekTokenIs(token.AND) {
+			return call
+		}
+		p.nextToken() // consume AND
+	}
 }
 
 // parseWhileStatement parses: while x is less than 100 do ... done
@@ -496,111 +1893,432 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	stmt := &ast.WhileStatement{Token: p.curToken}
 
 	p.nextToken()
-	stmt.Condition = p.parseCondition()
+	stmt.Condition = p.parseExpression()
+
+	if !p.expectPeek(token.DO) {
+		return nil
+	}
+
+	p.nextToken() // move past DO
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForStatement parses:
+// - for each item in items do ... done
+// - for each key and value in data do ... done
+// - for each n from 1 to 10 [by 2] do ... done
+func (p *Parser) parseForStatement() ast.Statement {
+	forToken := p.curToken
+
+	if !p.expectPeek(token.EACH) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	variable := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.FROM) {
+		return p.parseForRangeStatement(forToken, variable)
+	}
+
+	stmt := &ast.ForStatement{Token: forToken, Variable: variable}
+
+	if p.peekTokenIs(token.AND) {
+		p.nextToken() // consume AND
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parsePrimary()
+
+	if !p.expectPeek(token.DO) {
+		return nil
+	}
+
+	p.nextToken() // move past DO
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseForRangeStatement parses the rest of: for each n from 1 to 10 [by 2] do ... done
+func (p *Parser) parseForRangeStatement(forToken token.Token, variable *ast.Identifier) ast.Statement {
+	stmt := &ast.ForRangeStatement{Token: forToken, Variable: variable}
+
+	p.nextToken() // consume FROM
+	p.nextToken()
+	stmt.From = p.parseExpression()
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	p.nextToken()
+	stmt.To = p.parseExpression()
+
+	if p.peekTokenIs(token.BY) {
+		p.nextToken() // consume BY
+		p.nextToken()
+		stmt.Step = p.parseExpression()
+	}
+
+	if !p.expectPeek(token.DO) {
+		return nil
+	}
+
+	p.nextToken() // move past DO
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseRepeatStatement parses: repeat 5 times do ... done
+func (p *Parser) parseRepeatStatement() *ast.RepeatStatement {
+	stmt := &ast.RepeatStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Count = p.parseExpression()
 
+	if !p.expectPeek(token.TIMES) {
+		return nil
+	}
 	if !p.expectPeek(token.DO) {
 		return nil
 	}
 
-	p.nextToken() // move past DO
-	stmt.Body = p.parseBlockStatement()
-
-	return stmt
+	p.nextToken() // move past DO
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// parseLoopBody parses a loop's block, where "stop the loop" and
+// "skip to next" are allowed
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+// parseStopLoopStatement parses: stop the loop
+func (p *Parser) parseStopLoopStatement() *ast.StopLoopStatement {
+	stmt := &ast.StopLoopStatement{Token: p.curToken}
+
+	p.nextToken() // consume THE
+	if !p.expectPeek(token.LOOP) {
+		return nil
+	}
+
+	if p.loopDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: 'stop the loop' used outside a loop", stmt.Token.Line))
+		return nil
+	}
+
+	return stmt
+}
+
+// parseSkipStatement parses: skip to next
+func (p *Parser) parseSkipStatement() *ast.SkipStatement {
+	stmt := &ast.SkipStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	if !p.expectPeek(token.NEXT) {
+		return nil
+	}
+
+	if p.loopDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: 'skip to next' used outside a loop", stmt.Token.Line))
+		return nil
+	}
+
+	return stmt
+}
+
+// parseBlockStatement parses statements until "done"
+func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	return p.parseBlockUntil()
+}
+
+// parseBlockUntil parses statements up to DONE, OTHERWISE, EOF or any of
+// the extra terminators given
+func (p *Parser) parseBlockUntil(terminators ...token.TokenType) *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.curToken}
+	block.Statements = []ast.Statement{}
+
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
+	for !p.curTokenIs(token.DONE) && !p.curTokenIs(token.OTHERWISE) && !p.curTokenIs(token.EOF) {
+		if p.curTokenIsAny(terminators) {
+			break
+		}
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		p.nextToken()
+	}
+
+	return block
+}
+
+// parseFunctionDefinition parses: to funcname with param1 and param2 ... done
+func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
+	stmt := &ast.FunctionDefinition{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Parameters = []*ast.Identifier{}
+
+	// Check for parameters
+	if p.peekTokenIs(token.WITH) {
+		p.nextToken() // consume WITH
+		stmt.Parameters, stmt.Defaults = p.parseParameters()
+		if stmt.Parameters == nil {
+			return nil
+		}
+	}
+
+	p.nextToken() // move to body
+	stmt.Body = p.parseFunctionBody()
+
+	return stmt
+}
+
+// parseParameters parses the names after WITH: x and y defaulting to 1
+// It returns the parameters and, for each one, its default value or nil.
+// Parameters with defaults must come after the required ones.
+func (p *Parser) parseParameters() ([]*ast.Identifier, []ast.Expression) {
+	params := []*ast.Identifier{}
+	defaults := []ast.Expression{}
+	optional := false
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil, nil
+		}
+		param := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		var value ast.Expression
+		if p.peekTokenIs(token.DEFAULTING) {
+			p.nextToken() // consume DEFAULTING
+			if !p.expectPeek(token.TO) {
+				return nil, nil
+			}
+			p.nextToken()
+			value = p.parseOperand()
+			if value == nil {
+				return nil, nil
+			}
+			optional = true
+		} else if optional {
+			p.errors = append(p.errors, fmt.Sprintf("line %d: parameter %s needs a default, because it follows one that has a default",
+				param.Token.Line, param.Value))
+			return nil, nil
+		}
+		params = append(params, param)
+		defaults = append(defaults, value)
+
+		// Handle multiple parameters with "and"
+		if !p.peekTokenIs(token.AND) {
+			return params, defaults
+		}
+		p.nextToken() // consume AND
+	}
+}
+
+// parseFunctionLiteral parses an unnamed function in either form:
+// - a function with x that returns x times 2
+// - a function with x do ... done
+// A "that returns" body extends as far right as it can, so wrap the whole
+// function in parentheses when more arguments follow it.
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken, Parameters: []*ast.Identifier{}}
+
+	p.nextToken() // consume A, now at FUNCTION
+
+	if p.peekTokenIs(token.WITH) {
+		p.nextToken() // consume WITH
+		lit.Parameters, lit.Defaults = p.parseParameters()
+		if lit.Parameters == nil {
+			return nil
+		}
+	}
+
+	switch {
+	case p.peekTokenIs(token.THAT):
+		p.nextToken() // consume THAT
+		if !p.expectPeek(token.RETURNS) {
+			return nil
+		}
+		ret := &ast.ReturnStatement{Token: p.curToken}
+		p.nextToken()
+		ret.ReturnValue = p.parseExpression()
+		if ret.ReturnValue == nil {
+			return nil
+		}
+		lit.Body = &ast.BlockStatement{Token: ret.Token, Statements: []ast.Statement{ret}}
+	case p.peekTokenIs(token.DO):
+		p.nextToken() // consume DO
+		p.nextToken() // move to body
+		lit.Body = p.parseFunctionBody()
+		if !p.curTokenIs(token.DONE) {
+			p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'done' to close function", lit.Token.Line))
+			return nil
+		}
+	default:
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'that returns' or 'do' after 'a function', got %s",
+			p.peekToken.Line, p.peekToken.Type))
+		return nil
+	}
+
+	return lit
 }
 
-// parseForStatement parses: for each item in items do ... done
-func (p *Parser) parseForStatement() *ast.ForStatement {
-	stmt := &ast.ForStatement{Token: p.curToken}
+// parseFunctionBody parses the block of a function or request handler,
+// which starts outside any loop even if it is written inside one
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	outerLoops := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = outerLoops }()
+	return p.parseBlockStatement()
+}
 
-	if !p.expectPeek(token.EACH) {
-		return nil
+// parseTryStatement parses:
+// - try ... if it fails with problem ... done
+// - try ... if it fails ... done
+// - try ... otherwise ... done
+func (p *Parser) parseTryStatement() *ast.TryStatement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	p.nextToken() // move past TRY
+
+	// The body runs until "if it fails", "otherwise" or "done"
+	stmt.Body = &ast.BlockStatement{Token: p.curToken, Statements: []ast.Statement{}}
+	p.blockDepth++
+	for !p.curTokenIs(token.DONE) && !p.curTokenIs(token.OTHERWISE) && !p.curTokenIs(token.EOF) &&
+		!(p.curTokenIs(token.IF) && p.peekTokenIs(token.IT)) {
+		s := p.parseStatement()
+		if s != nil {
+			stmt.Body.Statements = append(stmt.Body.Statements, s)
+		}
+		p.nextToken()
 	}
+	p.blockDepth--
 
-	if !p.expectPeek(token.IDENT) {
+	switch {
+	case p.curTokenIs(token.IF):
+		p.nextToken() // consume IF, now at IT
+		if !p.expectPeek(token.FAILS) {
+			return nil
+		}
+		if p.peekTokenIs(token.WITH) {
+			p.nextToken() // consume WITH
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.ErrorVar = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		}
+		p.nextToken() // move to first statement of handler
+		stmt.Handler = p.parseBlockStatement()
+	case p.curTokenIs(token.OTHERWISE):
+		p.nextToken() // move to first statement of handler
+		stmt.Handler = p.parseBlockStatement()
+	case p.curTokenIs(token.EOF):
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'done' to close try", stmt.Token.Line))
 		return nil
 	}
 
-	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return stmt
+}
 
-	if !p.expectPeek(token.IN) {
-		return nil
-	}
+// parseRaiseStatement parses: raise "message"
+func (p *Parser) parseRaiseStatement() *ast.RaiseStatement {
+	stmt := &ast.RaiseStatement{Token: p.curToken}
 
 	p.nextToken()
-	stmt.Iterable = p.parsePrimary()
-
-	if !p.expectPeek(token.DO) {
-		return nil
-	}
-
-	p.nextToken() // move past DO
-	stmt.Body = p.parseBlockStatement()
+	stmt.Message = p.parseExpression()
 
 	return stmt
 }
 
-// parseBlockStatement parses statements until "done"
-func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{Token: p.curToken}
-	block.Statements = []ast.Statement{}
+// parseReturnStatement parses: return x
+func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	stmt := &ast.ReturnStatement{Token: p.curToken}
 
-	for !p.curTokenIs(token.DONE) && !p.curTokenIs(token.OTHERWISE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
-		}
-		p.nextToken()
+	p.nextToken()
+
+	// Check if there's a return value (not at end of block or EOF)
+	if !p.curTokenIs(token.DONE) && !p.curTokenIs(token.EOF) {
+		stmt.ReturnValue = p.parseExpression()
 	}
 
-	return block
+	return stmt
 }
 
-// parseFunctionDefinition parses: to funcname with param1 and param2 ... done
-func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
-	stmt := &ast.FunctionDefinition{Token: p.curToken}
+// parseUseStatement parses: use "lib/auth.abc", or use auth from
+// "lib/auth.abc", and the same with standard "lists" for a built-in module
+func (p *Parser) parseUseStatement() *ast.UseStatement {
+	stmt := &ast.UseStatement{Token: p.curToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.blockDepth > 0 {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: use must be at the top level of a file", p.curToken.Line))
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	stmt.Parameters = []*ast.Identifier{}
-
-	// Check for parameters
-	if p.peekTokenIs(token.WITH) {
-		p.nextToken() // consume WITH
-		p.nextToken() // move to first parameter
-
-		param := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		stmt.Parameters = append(stmt.Parameters, param)
+	if p.peekTokenIs(token.IDENT) && p.peek2TokenIs(token.FROM) {
+		p.nextToken()
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken() // move to FROM
+	}
 
-		// Handle multiple parameters with "and"
-		for p.peekTokenIs(token.AND) {
-			p.nextToken() // consume AND
-			p.nextToken() // move to parameter
-			param := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-			stmt.Parameters = append(stmt.Parameters, param)
-		}
+	if p.peekToken.Literal == "standard" && p.peek2TokenIs(token.STRING) {
+		p.nextToken()
+		stmt.Standard = true
 	}
 
-	p.nextToken() // move to body
-	stmt.Body = p.parseBlockStatement()
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
 
 	return stmt
 }
 
-// parseReturnStatement parses: return x
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curToken}
-
-	p.nextToken()
+// parseExportStatement parses: export check_token and make_user
+func (p *Parser) parseExportStatement() *ast.ExportStatement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
 
-	// Check if there's a return value (not at end of block or EOF)
-	if !p.curTokenIs(token.DONE) && !p.curTokenIs(token.EOF) {
-		stmt.ReturnValue = p.parseExpression()
+	if p.blockDepth > 0 {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: export must be at the top level of a file", p.curToken.Line))
 	}
 
-	return stmt
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Names = append(stmt.Names, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+		if !p.peekTokenIs(token.AND) {
+			return stmt
+		}
+		p.nextToken() // consume AND
+	}
 }
 
 // parseSayStatement parses: say x or say "hello"
@@ -613,6 +2331,19 @@ func (p *Parser) parseSayStatement() *ast.SayStatement {
 	return stmt
 }
 
+// parseExpressionStatement parses an expression on its own line, such as
+// call greet or greet with "Alice"
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+
+	stmt.Expression = p.parseExpression()
+	if stmt.Expression == nil {
+		return nil
+	}
+
+	return stmt
+}
+
 // parseAskStatement parses: ask into answer
 func (p *Parser) parseAskStatement() *ast.AskStatement {
 	stmt := &ast.AskStatement{Token: p.curToken}
@@ -647,7 +2378,7 @@ func (p *Parser) parseIndexExpression() *ast.IndexExpression {
 	expr := &ast.IndexExpression{Token: p.curToken}
 
 	p.nextToken() // move past ITEM
-	expr.Index = p.parsePrimary()
+	expr.Index = p.parseOperand()
 
 	if !p.expectPeek(token.FROM) {
 		return nil
@@ -659,6 +2390,99 @@ func (p *Parser) parseIndexExpression() *ast.IndexExpression {
 	return expr
 }
 
+// parseFirstOrLastItem parses: first item from list, last item from list
+func (p *Parser) parseFirstOrLastItem() ast.Expression {
+	expr := &ast.IndexExpression{Token: p.curToken, Index: p.endPosition()}
+
+	p.nextToken() // consume first or last, now at ITEM
+	p.nextToken() // consume ITEM, now at FROM
+	p.nextToken() // consume FROM, now at list expression
+
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// startsSlice reports whether the current "items" begins "items 2 to 5 from
+// list" rather than naming a variable
+func (p *Parser) startsSlice() bool {
+	if p.peekToken.Line != p.curToken.Line {
+		return false
+	}
+	switch {
+	case p.peekTokenIs(token.NUMBER), p.peekTokenIs(token.MINUS), p.peekTokenIs(token.LPAREN),
+		token.IsNumberWord(p.peekToken.Type):
+		return true
+	case p.peekTokenIs(token.IDENT):
+		return p.peek2TokenIs(token.TO)
+	}
+	return false
+}
+
+// parseSliceExpression parses: items 2 to 5 from list
+func (p *Parser) parseSliceExpression() ast.Expression {
+	expr := &ast.SliceExpression{Token: p.curToken}
+
+	p.nextToken() // consume "items"
+	expr.From = p.parseOperand()
+	if expr.From == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.TO) {
+		return nil
+	}
+	p.nextToken()
+	expr.To = p.parseOperand()
+	if expr.To == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.FROM) {
+		return nil
+	}
+	p.nextToken()
+	expr.List = p.parsePrimary()
+	if expr.List == nil {
+		return nil
+	}
+	return expr
+}
+
+// peekItemPosition reports whether the next tokens name a position in a
+// list: item 2, first item or last item
+func (p *Parser) peekItemPosition() bool {
+	if p.peekTokenIs(token.ITEM) {
+		return true
+	}
+	return (p.peekToken.Literal == "first" || p.peekToken.Literal == "last") && p.peek2TokenIs(token.ITEM)
+}
+
+// parseItemPosition parses the position after the current token, leaving
+// the parser on its last token. "first item" is position 1 and "last item"
+// position -1, which counts back from the end.
+func (p *Parser) parseItemPosition() ast.Expression {
+	p.nextToken()
+	if p.curTokenIs(token.IDENT) {
+		position := p.endPosition()
+		p.nextToken() // consume first or last, now at ITEM
+		return position
+	}
+
+	p.nextToken() // consume ITEM
+	return p.parseOperand()
+}
+
+// endPosition returns the position the current "first" or "last" stands for
+func (p *Parser) endPosition() ast.Expression {
+	if p.curToken.Literal == "last" {
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.NUMBER, Literal: "-1", Line: p.curToken.Line, Column: p.curToken.Column}, Value: -1}
+	}
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.NUMBER, Literal: "1", Line: p.curToken.Line, Column: p.curToken.Column}, Value: 1}
+}
+
 // parseAppendStatement parses: append value to items
 func (p *Parser) parseAppendStatement() *ast.AppendStatement {
 	stmt := &ast.AppendStatement{Token: p.curToken}
@@ -679,11 +2503,6 @@ func (p *Parser) parseAppendStatement() *ast.AppendStatement {
 	return stmt
 }
 
-// parseExpression is the main entry point for expression parsing
-func (p *Parser) parseExpression() ast.Expression {
-	return p.parseArithmeticExpression()
-}
-
 // parseListLiteral parses: a list of 1 and 2 and 3
 func (p *Parser) parseListLiteral() *ast.ListLiteral {
 	list := &ast.ListLiteral{Token: p.curToken}
@@ -701,24 +2520,200 @@ func (p *Parser) parseListLiteral() *ast.ListLiteral {
 
 	// curToken is OF, advance to first element
 	p.nextToken()
-	elem := p.parsePrimary()
+	elem := p.parseOperand()
 	list.Elements = append(list.Elements, elem)
 
 	for p.peekTokenIs(token.AND) {
 		p.nextToken() // consume AND
 		p.nextToken() // move to next element
-		elem := p.parsePrimary()
+		elem := p.parseOperand()
 		list.Elements = append(list.Elements, elem)
 	}
 
 	return list
 }
 
-// parseNumberWord parses English number words like "forty two"
-func (p *Parser) parseNumberWord() *ast.IntegerLiteral {
+// parseDictionaryLiteral parses: a dictionary with "name" as "Alice" and "age" as 30
+// A bare "a dictionary" creates an empty dictionary.
+func (p *Parser) parseDictionaryLiteral() *ast.DictionaryLiteral {
+	dict := &ast.DictionaryLiteral{Token: p.curToken}
+	dict.Pairs = []ast.DictionaryPair{}
+
+	// curToken is A, advance to DICTIONARY
+	if !p.expectPeek(token.DICTIONARY) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.WITH) {
+		return dict
+	}
+	p.nextToken() // consume WITH
+
+	for {
+		p.nextToken() // move to key
+		key := p.parsePrimary()
+
+		if !p.expectPeek(token.AS) {
+			return nil
+		}
+
+		p.nextToken() // move to value
+		value := p.parseOperand()
+		dict.Pairs = append(dict.Pairs, ast.DictionaryPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.AND) {
+			break
+		}
+		p.nextToken() // consume AND
+	}
+
+	return dict
+}
+
+// parseKeysOfExpression parses: keys of user
+func (p *Parser) parseKeysOfExpression() *ast.KeysOfExpression {
+	expr := &ast.KeysOfExpression{Token: p.curToken}
+
+	p.nextToken() // consume KEYS, now at OF
+	p.nextToken() // consume OF, now at source expression
+
+	expr.Source = p.parsePrimary()
+
+	return expr
+}
+
+// parseValuesOfExpression parses: values of user
+func (p *Parser) parseValuesOfExpression() *ast.ValuesOfExpression {
+	expr := &ast.ValuesOfExpression{Token: p.curToken}
+
+	p.nextToken() // consume VALUES, now at OF
+	p.nextToken() // consume OF, now at source expression
+
+	expr.Source = p.parsePrimary()
+
+	return expr
+}
+
+// parseRemoveStatement parses: remove "age" from user, remove "milk" from
+// items or remove item 3 from items
+func (p *Parser) parseRemoveStatement() *ast.RemoveStatement {
+	stmt := &ast.RemoveStatement{Token: p.curToken}
+
+	if p.peekItemPosition() {
+		stmt.Position = p.parseItemPosition()
+		if stmt.Position == nil {
+			return nil
+		}
+	} else {
+		p.nextToken()
+		stmt.Key = p.parseExpression()
+	}
+
+	if !p.expectPeek(token.FROM) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Target = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return stmt
+}
+
+// parseInsertStatement parses: insert "milk" at position 2 in items
+func (p *Parser) parseInsertStatement() *ast.InsertStatement {
+	stmt := &ast.InsertStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression()
+
+	if !p.expectPeek(token.AT) {
+		return nil
+	}
+	p.nextToken()
+	if p.curToken.Literal != "position" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected 'position' after 'at', got %s",
+			p.curToken.Line, p.curToken.Type))
+		return nil
+	}
+	p.nextToken()
+	stmt.Position = p.parseOperand()
+	if stmt.Position == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Target = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return stmt
+}
+
+// parsePopStatement parses: pop from items, or pop item 1 from items into first
+func (p *Parser) parsePopStatement() *ast.PopStatement {
+	stmt := &ast.PopStatement{Token: p.curToken}
+
+	if p.peekItemPosition() {
+		stmt.Position = p.parseItemPosition()
+		if stmt.Position == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.FROM) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Target = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.INTO) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Into = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	return stmt
+}
+
+// parseNumberWord parses English number words like "forty two" or "two point five"
+func (p *Parser) parseNumberWord() ast.Expression {
 	startToken := p.curToken
 	value := p.parseCompoundNumber()
-	return &ast.IntegerLiteral{Token: startToken, Value: value}
+
+	if !p.peekTokenIs(token.POINT) {
+		return &ast.IntegerLiteral{Token: startToken, Value: value}
+	}
+
+	p.nextToken() // consume POINT
+
+	// Each word after "point" is a single digit: "three point one four"
+	digits := ""
+	for token.IsDigitWord(p.peekToken.Type) {
+		p.nextToken()
+		digits += strconv.FormatInt(token.NumberWordValue(p.curToken.Type), 10)
+	}
+	if digits == "" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: expected digit words after 'point', got %s",
+			p.peekToken.Line, p.peekToken.Type))
+		return nil
+	}
+
+	decimal, err := strconv.ParseFloat(strconv.FormatInt(value, 10)+"."+digits, 64)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d: could not parse decimal number", startToken.Line))
+		return nil
+	}
+	return &ast.FloatLiteral{Token: startToken, Value: decimal}
 }
 
 // parseCompoundNumber handles compound numbers like "forty two", "one hundred twenty three"
@@ -767,7 +2762,7 @@ func (p *Parser) parseFetchStatement() *ast.FetchStatement {
 	}
 
 	p.nextToken()
-	stmt.URL = p.parseExpression()
+	stmt.URL = p.parseExpressionBeforeWith()
 
 	// Check for optional "with headers"
 	if p.peekTokenIs(token.WITH) {
@@ -800,7 +2795,7 @@ func (p *Parser) parseSendStatement() *ast.SendStatement {
 	}
 
 	p.nextToken()
-	stmt.URL = p.parseExpression()
+	stmt.URL = p.parseExpressionBeforeWith()
 
 	// Check for optional "with headers"
 	if p.peekTokenIs(token.WITH) {
@@ -833,7 +2828,7 @@ func (p *Parser) parsePutStatement() *ast.PutStatement {
 	}
 
 	p.nextToken()
-	stmt.URL = p.parseExpression()
+	stmt.URL = p.parseExpressionBeforeWith()
 
 	// Check for optional "with headers"
 	if p.peekTokenIs(token.WITH) {
@@ -863,7 +2858,7 @@ func (p *Parser) parseDeleteStatement() *ast.DeleteStatement {
 	}
 
 	p.nextToken()
-	stmt.URL = p.parseExpression()
+	stmt.URL = p.parseExpressionBeforeWith()
 
 	// Check for optional "with headers"
 	if p.peekTokenIs(token.WITH) {
@@ -1082,12 +3077,13 @@ func (p *Parser) parseWhenRouteStatement() *ast.WhenRouteStatement {
 	}
 
 	p.nextToken() // move past DO
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseFunctionBody()
 
 	return stmt
 }
 
 // parseRouteToStatement parses: route "/path" to handlerFunc
+// or route "/path" to a function with req do ... done
 func (p *Parser) parseRouteToStatement() *ast.RouteToStatement {
 	stmt := &ast.RouteToStatement{Token: p.curToken}
 
@@ -1098,10 +3094,11 @@ func (p *Parser) parseRouteToStatement() *ast.RouteToStatement {
 		return nil
 	}
 
-	if !p.expectPeek(token.IDENT) {
+	p.nextToken()
+	stmt.Handler = p.parseExpression()
+	if stmt.Handler == nil {
 		return nil
 	}
-	stmt.Handler = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	return stmt
 }
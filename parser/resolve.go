@@ -0,0 +1,252 @@
+package parser
+
+import "az-lang/ast"
+
+// Scope records the variables that live in one runtime environment: the
+// program, a function call or a request handler. Blocks such as if, while
+// and try share the scope around them. Each pass through a for each loop
+// gets a block scope of its own that holds only the loop variables, so
+// functions created in the loop keep the values from their pass.
+type Scope struct {
+	names   map[string]bool
+	globals map[string]bool // names declared with "global" in this scope
+	outer   *Scope
+	block   bool
+}
+
+// NewScope returns an empty top-level scope. The REPL keeps one across
+// inputs so later lines can assign to variables from earlier ones.
+func NewScope() *Scope {
+	return newScope(nil)
+}
+
+// newScope returns a scope inside outer that defines the given names.
+// Absent optional names are skipped.
+func newScope(outer *Scope, names ...*ast.Identifier) *Scope {
+	scope := &Scope{names: make(map[string]bool), globals: make(map[string]bool), outer: outer}
+	for _, name := range names {
+		if name != nil {
+			scope.declare(name.Value)
+		}
+	}
+	return scope
+}
+
+// newLoopScope returns the block scope for one pass through a loop
+func newLoopScope(outer *Scope, variables ...*ast.Identifier) *Scope {
+	scope := newScope(outer, variables...)
+	scope.block = true
+	return scope
+}
+
+func (s *Scope) declare(name string) {
+	s.names[name] = true
+}
+
+// function returns the nearest scope that is not a loop block, which is
+// where new variables are created
+func (s *Scope) function() *Scope {
+	scope := s
+	for scope.block {
+		scope = scope.outer
+	}
+	return scope
+}
+
+// blockDepth returns how many loop blocks lie between s and its function scope
+func (s *Scope) blockDepth() int {
+	depth := 0
+	for scope := s; scope.block; scope = scope.outer {
+		depth++
+	}
+	return depth
+}
+
+// depthOf returns how many scopes out from s the variable name lives,
+// or -1 if no enclosing scope defines it
+func (s *Scope) depthOf(name string) int {
+	depth := 0
+	for scope := s; scope != nil; scope = scope.outer {
+		if scope.globals[name] {
+			return depth + scope.distanceToTop()
+		}
+		if scope.names[name] {
+			return depth
+		}
+		depth++
+	}
+	return -1
+}
+
+func (s *Scope) distanceToTop() int {
+	distance := 0
+	for scope := s; scope.outer != nil; scope = scope.outer {
+		distance++
+	}
+	return distance
+}
+
+func (s *Scope) top() *Scope {
+	scope := s
+	for scope.outer != nil {
+		scope = scope.outer
+	}
+	return scope
+}
+
+// resolve decides, once, which scope every assignment writes to and
+// records it as the Depth of the target. Assigning to a name that an
+// enclosing scope already defines updates that variable; otherwise the
+// assignment creates a variable in the current function scope. "let" and
+// parameters always belong to the current function, and loop variables to
+// the loop.
+func resolve(statements []ast.Statement, scope *Scope) {
+	declare(statements, scope)
+	resolveTargets(statements, scope)
+}
+
+// declare collects what a scope defines before anything is resolved, so a
+// function can assign to a top-level variable that is set further down the
+// file
+func declare(statements []ast.Statement, scope *Scope) {
+	fn := scope.function()
+
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			fn.declare(n.Name.Value)
+		case *ast.GlobalStatement:
+			for _, name := range n.Names {
+				fn.globals[name.Value] = true
+				fn.top().declare(name.Value)
+			}
+		case *ast.ForStatement:
+			ast.Walk(n.Iterable, visit)
+			declare(n.Body.Statements, newLoopScope(scope, n.Variable, n.Value))
+			return false
+		case *ast.ForRangeStatement:
+			ast.Walk(n.From, visit)
+			ast.Walk(n.To, visit)
+			ast.Walk(n.Step, visit)
+			declare(n.Body.Statements, newLoopScope(scope, n.Variable))
+			return false
+		case *ast.TryStatement:
+			if n.ErrorVar != nil {
+				fn.declare(n.ErrorVar.Value)
+			}
+		case *ast.FunctionDefinition:
+			fn.declare(n.Name.Value)
+			return false
+		case *ast.FunctionLiteral, *ast.WhenRouteStatement:
+			return false
+		default:
+			if target := assignmentTarget(node); target != nil && scope.depthOf(target.Value) < 0 {
+				fn.declare(target.Value)
+			}
+		}
+		return true
+	}
+
+	for _, stmt := range statements {
+		ast.Walk(stmt, visit)
+	}
+}
+
+// resolveTargets sets the depth of every assignment target and resolves
+// the scopes nested in this one
+func resolveTargets(statements []ast.Statement, scope *Scope) {
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.LetStatement:
+			n.Name.Depth = scope.blockDepth()
+		case *ast.TryStatement:
+			if n.ErrorVar != nil {
+				n.ErrorVar.Depth = scope.blockDepth()
+			}
+		case *ast.IncreaseStatement:
+			n.Target.Depth = existingDepth(scope, n.Target.Value)
+		case *ast.DecreaseStatement:
+			n.Target.Depth = existingDepth(scope, n.Target.Value)
+		case *ast.ForStatement:
+			ast.Walk(n.Iterable, visit)
+			resolveTargets(n.Body.Statements, newLoopScope(scope, n.Variable, n.Value))
+			return false
+		case *ast.ForRangeStatement:
+			ast.Walk(n.From, visit)
+			ast.Walk(n.To, visit)
+			ast.Walk(n.Step, visit)
+			resolveTargets(n.Body.Statements, newLoopScope(scope, n.Variable))
+			return false
+		case *ast.FunctionDefinition:
+			resolveFunction(n.Parameters, n.Defaults, n.Body, scope)
+			return false
+		case *ast.FunctionLiteral:
+			resolveFunction(n.Parameters, n.Defaults, n.Body, scope)
+			return false
+		case *ast.WhenRouteStatement:
+			resolve(n.Body.Statements, newScope(scope, n.RequestVar))
+			return false
+		default:
+			if target := assignmentTarget(node); target != nil {
+				target.Depth = scope.depthOf(target.Value)
+			}
+		}
+		return true
+	}
+
+	for _, stmt := range statements {
+		ast.Walk(stmt, visit)
+	}
+}
+
+// resolveFunction resolves a function's body, and any functions written in
+// its default values, in a new scope holding its parameters. Defaults are
+// evaluated in that scope when the function is called.
+func resolveFunction(params []*ast.Identifier, defaults []ast.Expression, body *ast.BlockStatement, outer *Scope) {
+	inner := newScope(outer, params...)
+	for _, d := range defaults {
+		if d != nil {
+			resolveTargets([]ast.Statement{&ast.ExpressionStatement{Expression: d}}, inner)
+		}
+	}
+	resolve(body.Statements, inner)
+}
+
+// assignmentTarget returns the variable a statement stores its result in,
+// for statements that follow the normal assignment rules
+func assignmentTarget(node ast.Node) *ast.Identifier {
+	switch n := node.(type) {
+	case *ast.SetStatement:
+		return n.Name
+	case *ast.AskStatement:
+		return n.Target
+	case *ast.FetchStatement:
+		return n.Target
+	case *ast.SendStatement:
+		return n.Target
+	case *ast.PutStatement:
+		return n.Target
+	case *ast.DeleteStatement:
+		return n.Target
+	case *ast.ParseJsonStatement:
+		return n.Target
+	case *ast.EncodeJsonStatement:
+		return n.Target
+	case *ast.PopStatement:
+		return n.Into
+	case *ast.UseStatement:
+		return n.Name
+	}
+	return nil
+}
+
+// existingDepth resolves a variable that must already exist. Unknown names
+// stay in the current scope and are reported as undefined when run.
+func existingDepth(scope *Scope, name string) int {
+	if depth := scope.depthOf(name); depth >= 0 {
+		return depth
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+// Package stdlib holds the standard modules, written in az-lang and built
+// into the abc binary. Scripts load them with: use standard "lists"
+package stdlib
+
+import "embed"
+
+//go:embed *.abc
+var files embed.FS
+
+// Source returns the source of the standard module called name, such as
+// "lists", and whether there is one
+func Source(name string) (string, bool) {
+	content, err := files.ReadFile(name + ".abc")
+	if err != nil {
+		return "", false
+	}
+	return string(content), true
+}
@@ -0,0 +1,69 @@
+package stdlib_test
+
+import (
+	"az-lang/interpreter"
+	"az-lang/lexer"
+	"az-lang/object"
+	"az-lang/parser"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestModules runs each script in tests/, which raises an error at the
+// first check that fails
+func TestModules(t *testing.T) {
+	scripts, err := filepath.Glob("tests/*_test.abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no test scripts in tests/")
+	}
+
+	for _, script := range scripts {
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			source, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := parser.New(lexer.New(string(source)))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			// Scripts that start a server use this port instead of a fixed one
+			env := object.NewFileEnvironment(script)
+			env.Set("port", &object.Integer{Value: int64(freePort(t))})
+
+			result := interpreter.Eval(program, env)
+			if err, ok := result.(*object.Error); ok {
+				file := err.File
+				if file == "" {
+					file = script
+				}
+				message := fmt.Sprintf("%s:%d: %s", file, err.Line, err.Message)
+				for _, frame := range err.Stack {
+					message += fmt.Sprintf("\n\tin %s, called at line %d", frame.Function, frame.Line)
+				}
+				t.Fatal(message)
+			}
+		})
+	}
+}
+
+// freePort returns a port that nothing is listening on, skipping the test
+// if the system won't give one
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Skipf("could not find a free port: %s", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
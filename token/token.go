@@ -9,15 +9,32 @@ type Token struct {
 	Column  int
 }
 
+// Position is a line and column in source code, both starting at 1
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
 const (
 	// Special tokens
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
 	// Literals
-	IDENT  = "IDENT"  // variable names, function names
-	NUMBER = "NUMBER" // numeric literal (digits)
-	STRING = "STRING" // quoted string literal
+	IDENT    = "IDENT"    // variable names, function names
+	NUMBER   = "NUMBER"   // numeric literal (digits, optionally with a decimal part)
+	STRING   = "STRING"   // quoted string literal
+	TEMPLATE = "TEMPLATE" // quoted string containing {expressions}
+
+	// Punctuation
+	COLON      = ":"
+	LPAREN     = "("
+	RPAREN     = ")"
+	POSSESSIVE = "'s" // auth's check_token
 
 	// Keywords - Variables
 	SET = "SET"
@@ -43,6 +60,27 @@ const (
 	GREATER   = "GREATER"
 	LESS      = "LESS"
 	THAN      = "THAN"
+	CHECK     = "CHECK"
+
+	// Keywords - Comparisons
+	EQUAL    = "EQUAL"
+	DOES     = "DOES"
+	LEAST    = "LEAST"
+	MOST     = "MOST"
+	BETWEEN  = "BETWEEN"
+	EMPTY    = "EMPTY"
+	CONTAINS = "CONTAINS"
+	CONTAIN  = "CONTAIN"
+	STARTS   = "STARTS"
+	ENDS     = "ENDS"
+	MATCHES  = "MATCHES"
+
+	// Keywords - Loop control
+	REPEAT = "REPEAT"
+	THE    = "THE"
+	LOOP   = "LOOP"
+	SKIP   = "SKIP"
+	NEXT   = "NEXT"
 
 	// Keywords - Logical
 	AND = "AND"
@@ -59,10 +97,29 @@ const (
 	// Keywords - Blocks
 	DONE = "DONE"
 
+	// Keywords - Scope
+	LET    = "LET"
+	BE     = "BE"
+	GLOBAL = "GLOBAL"
+
+	// Keywords - Error handling
+	TRY   = "TRY"
+	IT    = "IT"
+	FAILS = "FAILS"
+	RAISE = "RAISE"
+
 	// Keywords - Functions
-	RETURN = "RETURN"
-	CALL   = "CALL"
-	WITH   = "WITH"
+	RETURN     = "RETURN"
+	CALL       = "CALL"
+	WITH       = "WITH"
+	FUNCTION   = "FUNCTION"
+	THAT       = "THAT"
+	RETURNS    = "RETURNS"
+	DEFAULTING = "DEFAULTING"
+
+	// Keywords - Modules
+	USE    = "USE"
+	EXPORT = "EXPORT"
 
 	// Keywords - I/O
 	SAY = "SAY"
@@ -77,6 +134,22 @@ const (
 	GET    = "GET"
 	ITEM   = "ITEM"
 	FROM   = "FROM"
+	INSERT = "INSERT"
+	POP    = "POP"
+
+	// Keywords - List operations
+	WHERE       = "WHERE"
+	TRANSFORMED = "TRANSFORMED"
+	SORTED      = "SORTED"
+
+	// Keywords - Text
+	REPEATED = "REPEATED"
+
+	// Keywords - Dictionaries
+	DICTIONARY = "DICTIONARY"
+	REMOVE     = "REMOVE"
+	KEYS       = "KEYS"
+	VALUES     = "VALUES"
 
 	// Keywords - Comparison helpers
 	INTO = "INTO"
@@ -150,50 +223,99 @@ const (
 	HUNDRED  = "HUNDRED"
 	THOUSAND = "THOUSAND"
 	MILLION  = "MILLION"
+
+	// Decimal point in number words: "two point five"
+	POINT = "POINT"
 )
 
 var keywords = map[string]TokenType{
 	// Core keywords
-	"set":       SET,
-	"to":        TO,
-	"plus":      PLUS,
-	"times":     TIMES,
-	"divided":   DIVIDED,
-	"minus":     MINUS,
-	"increase":  INCREASE,
-	"decrease":  DECREASE,
-	"by":        BY,
-	"if":        IF,
-	"then":      THEN,
-	"otherwise": OTHERWISE,
-	"equals":    EQUALS,
-	"is":        IS,
-	"greater":   GREATER,
-	"less":      LESS,
-	"than":      THAN,
-	"and":       AND,
-	"or":        OR,
-	"not":       NOT,
-	"while":     WHILE,
-	"do":        DO,
-	"for":       FOR,
-	"each":      EACH,
-	"in":        IN,
-	"done":      DONE,
-	"return":    RETURN,
-	"call":      CALL,
-	"with":      WITH,
-	"say":       SAY,
-	"ask":       ASK,
-	"a":         A,
-	"list":      LIST,
-	"of":        OF,
-	"length":    LENGTH,
-	"append":    APPEND,
-	"get":       GET,
-	"item":      ITEM,
-	"from":      FROM,
-	"into":      INTO,
+	"set":        SET,
+	"to":         TO,
+	"plus":       PLUS,
+	"times":      TIMES,
+	"divided":    DIVIDED,
+	"minus":      MINUS,
+	"increase":   INCREASE,
+	"decrease":   DECREASE,
+	"by":         BY,
+	"if":         IF,
+	"then":       THEN,
+	"otherwise":  OTHERWISE,
+	"equals":     EQUALS,
+	"is":         IS,
+	"greater":    GREATER,
+	"less":       LESS,
+	"than":       THAN,
+	"check":      CHECK,
+	"equal":      EQUAL,
+	"does":       DOES,
+	"least":      LEAST,
+	"most":       MOST,
+	"between":    BETWEEN,
+	"empty":      EMPTY,
+	"contains":   CONTAINS,
+	"contain":    CONTAIN,
+	"starts":     STARTS,
+	"ends":       ENDS,
+	"matches":    MATCHES,
+	"and":        AND,
+	"or":         OR,
+	"not":        NOT,
+	"while":      WHILE,
+	"do":         DO,
+	"for":        FOR,
+	"each":       EACH,
+	"repeat":     REPEAT,
+	"the":        THE,
+	"loop":       LOOP,
+	"skip":       SKIP,
+	"next":       NEXT,
+	"in":         IN,
+	"done":       DONE,
+	"let":        LET,
+	"be":         BE,
+	"global":     GLOBAL,
+	"try":        TRY,
+	"it":         IT,
+	"fails":      FAILS,
+	"raise":      RAISE,
+	"return":     RETURN,
+	"call":       CALL,
+	"with":       WITH,
+	"function":   FUNCTION,
+	"that":       THAT,
+	"returns":    RETURNS,
+	"defaulting": DEFAULTING,
+	"use":        USE,
+	"export":     EXPORT,
+	"say":        SAY,
+	"ask":        ASK,
+	"a":          A,
+	"list":       LIST,
+	"of":         OF,
+	"length":     LENGTH,
+	"append":     APPEND,
+	"get":        GET,
+	"item":       ITEM,
+	"from":       FROM,
+	"insert":     INSERT,
+	"pop":        POP,
+	"into":       INTO,
+
+	// List operation keywords
+	"where":       WHERE,
+	"transformed": TRANSFORMED,
+	"sorted":      SORTED,
+
+	// Text keywords
+	"repeated": REPEATED,
+
+	// Dictionary keywords
+	"dictionary": DICTIONARY,
+	"remove":     REMOVE,
+	"keys":       KEYS,
+	"values":     VALUES,
 
 	// HTTP keywords
 	"fetch":   FETCH,
@@ -260,6 +382,7 @@ var keywords = map[string]TokenType{
 	"hundred":   HUNDRED,
 	"thousand":  THOUSAND,
 	"million":   MILLION,
+	"point":     POINT,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -348,6 +471,16 @@ func NumberWordValue(t TokenType) int64 {
 	return 0
 }
 
+// IsDigitWord reports whether t is a single-digit number word (zero to nine),
+// the only words allowed after "point" in a decimal number
+func IsDigitWord(t TokenType) bool {
+	switch t {
+	case ZERO, ONE, TWO, THREE, FOUR, FIVE, SIX, SEVEN, EIGHT, NINE:
+		return true
+	}
+	return false
+}
+
 func IsMultiplier(t TokenType) bool {
 	return t == HUNDRED || t == THOUSAND || t == MILLION
 }